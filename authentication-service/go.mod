@@ -11,6 +11,7 @@ require (
 	golang.org/x/crypto v0.22.0
 	gorm.io/driver/postgres v1.5.7
 	gorm.io/gorm v1.25.9
+	lms-shared v0.0.0
 )
 
 require (
@@ -24,3 +25,5 @@ require (
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
+
+replace lms-shared => ../shared
@@ -0,0 +1,15 @@
+package data
+
+import (
+	"time"
+)
+
+type EmailChangeRequest struct {
+	ID          uint       `db:"id"`
+	CreatedAt   time.Time  `db:"created_at"`
+	UserID      uint       `db:"user_id"`
+	NewEmail    string     `db:"new_email"`
+	TokenHash   string     `db:"token_hash"`
+	ExpiresAt   time.Time  `db:"expires_at"`
+	ConfirmedAt *time.Time `db:"confirmed_at"`
+}
@@ -0,0 +1,13 @@
+package data
+
+import (
+	"time"
+)
+
+type LoginThrottle struct {
+	ID            uint       `db:"id"`
+	Key           string     `db:"key"`
+	Failures      int        `db:"failures"`
+	LastFailureAt time.Time  `db:"last_failure_at"`
+	BlockedUntil  *time.Time `db:"blocked_until"`
+}
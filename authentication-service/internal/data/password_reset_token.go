@@ -0,0 +1,14 @@
+package data
+
+import (
+	"time"
+)
+
+type PasswordResetToken struct {
+	ID        uint       `db:"id"`
+	CreatedAt time.Time  `db:"created_at"`
+	UserID    uint       `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
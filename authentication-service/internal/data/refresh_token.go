@@ -0,0 +1,16 @@
+package data
+
+import (
+	"time"
+)
+
+type RefreshToken struct {
+	ID        uint       `db:"id"`
+	CreatedAt time.Time  `db:"created_at"`
+	UserID    uint       `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	FamilyID  string     `db:"family_id"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	RevokedAt *time.Time `db:"revoked_at"`
+}
@@ -0,0 +1,13 @@
+package data
+
+import (
+	"time"
+)
+
+type RevokedToken struct {
+	ID        uint      `db:"id"`
+	CreatedAt time.Time `db:"created_at"`
+	JTI       string    `db:"jti"`
+	UserID    uint      `db:"user_id"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
@@ -0,0 +1,12 @@
+package data
+
+type Role struct {
+	ID          uint         `db:"id"`
+	Name        string       `db:"name"`
+	Permissions []Permission `gorm:"many2many:role_permissions;"`
+}
+
+type Permission struct {
+	ID   uint   `db:"id"`
+	Name string `db:"name"`
+}
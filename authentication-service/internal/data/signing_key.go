@@ -0,0 +1,13 @@
+package data
+
+import (
+	"time"
+)
+
+type SigningKey struct {
+	ID         uint       `db:"id"`
+	CreatedAt  time.Time  `db:"created_at"`
+	Kid        string     `db:"kid"`
+	PrivateKey []byte     `db:"private_key"`
+	RetiredAt  *time.Time `db:"retired_at"`
+}
@@ -0,0 +1,33 @@
+package data
+
+import (
+	"time"
+)
+
+type TwoFactor struct {
+	ID           uint      `db:"id"`
+	CreatedAt    time.Time `db:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at"`
+	UserID       uint      `db:"user_id"`
+	Secret       string    `db:"secret"`
+	Enabled      bool      `db:"enabled"`
+	LastUsedStep int64     `db:"last_used_step"`
+}
+
+type RecoveryCode struct {
+	ID        uint       `db:"id"`
+	CreatedAt time.Time  `db:"created_at"`
+	UserID    uint       `db:"user_id"`
+	CodeHash  string     `db:"code_hash"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+type LoginChallenge struct {
+	ID        uint       `db:"id"`
+	CreatedAt time.Time  `db:"created_at"`
+	UserID    uint       `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	Attempts  int        `db:"attempts"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
@@ -5,15 +5,17 @@ import (
 )
 
 type UserInfo struct {
-	ID             uint      `db:"id"`
-	CreatedAt      time.Time `db:"created_at"`
-	UpdatedAt      time.Time `db:"updated_at"`
-	FName          string    `db:"f_name"`
-	SName          string    `db:"s_name"`
-	Email          string    `db:"email"`
-	PasswordHash   []byte    `db:"password_hash"`
-	UserRole       string    `db:"user_role"`
-	Activated      bool      `db:"activated"`
-	Version        int       `db:"version"`
-	ActivationLink string    `db:"ActivationLink"`
+	ID                uint      `db:"id"`
+	CreatedAt         time.Time `db:"created_at"`
+	UpdatedAt         time.Time `db:"updated_at"`
+	FName             string    `db:"f_name"`
+	SName             string    `db:"s_name"`
+	Email             string    `db:"email"`
+	PasswordHash      []byte    `db:"password_hash"`
+	UserRole          string    `db:"user_role"`
+	Activated         bool      `db:"activated"`
+	Version           int       `db:"version"`
+	ActivationLink    string    `db:"ActivationLink"`
+	TokenVersion      int       `db:"token_version"`
+	PreferredLanguage string    `db:"preferred_language"`
 }
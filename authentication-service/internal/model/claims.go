@@ -3,10 +3,13 @@ package model
 import "github.com/dgrijalva/jwt-go"
 
 type Claims struct {
-	Username    string `json:"username"`
-	IsActivated bool   `json:"isActivated"`
-	Email       string `json:"email"`
-	UserId      uint   `json:"userId"`
-	ROLE        string `json:"role"`
+	Username     string   `json:"username"`
+	IsActivated  bool     `json:"isActivated"`
+	Email        string   `json:"email"`
+	UserId       uint     `json:"userId"`
+	ROLE         string   `json:"role"`
+	TokenVersion int      `json:"tokenVersion"`
+	Permissions  []string `json:"permissions"`
+	Language     string   `json:"language,omitempty"`
 	jwt.StandardClaims
 }
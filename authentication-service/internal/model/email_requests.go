@@ -0,0 +1,6 @@
+package model
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"newEmail"`
+	Password string `json:"password"`
+}
@@ -0,0 +1,5 @@
+package model
+
+type UpdateLanguageRequest struct {
+	PreferredLanguage string `json:"preferredLanguage"`
+}
@@ -0,0 +1,5 @@
+package model
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
@@ -0,0 +1,5 @@
+package model
+
+type RolePermissionsRequest struct {
+	Permissions []string `json:"permissions"`
+}
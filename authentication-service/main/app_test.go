@@ -2,18 +2,31 @@ package main
 
 import (
 	"assignment1/internal/data"
+	"assignment1/internal/model"
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func runTestServer() (*httptest.Server, func()) {
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=UTC", host, user, password, "testDB", port)
 	db = initDB(dsn)
-	db.AutoMigrate(&data.UserInfo{})
+	db.AutoMigrate(&data.UserInfo{}, &data.RefreshToken{}, &data.RevokedToken{}, &data.PasswordResetToken{}, &data.EmailChangeRequest{}, &data.SigningKey{},
+		&data.TwoFactor{}, &data.RecoveryCode{}, &data.LoginChallenge{}, &data.LoginThrottle{}, &data.Role{}, &data.Permission{})
+	if err := ensureDefaultRoles(); err != nil {
+		log.Fatalf("Could not create default roles: %v", err)
+	}
+	if err := loadSigningKeys(); err != nil {
+		log.Fatalf("Could not load signing keys: %v", err)
+	}
 
 	r := setupRoutes(db)
 
@@ -22,7 +35,7 @@ func runTestServer() (*httptest.Server, func()) {
 	// Return the server and a cleanup function
 	return ts, func() {
 		ts.Close()
-		db.Migrator().DropTable(&data.UserInfo{})
+		db.Migrator().DropTable("role_permissions", &data.Role{}, &data.Permission{}, &data.LoginThrottle{}, &data.LoginChallenge{}, &data.RecoveryCode{}, &data.TwoFactor{}, &data.SigningKey{}, &data.EmailChangeRequest{}, &data.PasswordResetToken{}, &data.RevokedToken{}, &data.RefreshToken{}, &data.UserInfo{})
 	}
 }
 
@@ -406,3 +419,479 @@ func TestDeleteUserInfoHandler(t *testing.T) {
 		t.Fatalf("Expected status No Content; got %v", resp.StatusCode)
 	}
 }
+
+// createActivatedUser inserts a user directly into the database so tests do
+// not depend on the registration flow.
+func createActivatedUser(t *testing.T, email, plainPassword, role string) data.UserInfo {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(plainPassword), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatalf("Could not hash password: %v", err)
+	}
+
+	user := data.UserInfo{
+		FName:        "Test User",
+		Email:        email,
+		PasswordHash: hashedPassword,
+		UserRole:     role,
+		Activated:    true,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Could not create user: %v", err)
+	}
+	return user
+}
+
+func postJSON(t *testing.T, url string, body interface{}) *http.Response {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("Could not encode body: %v", err)
+	}
+
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		t.Fatalf("Could not send request: %v", err)
+	}
+	return resp
+}
+
+func login(t *testing.T, ts *httptest.Server, email, plainPassword string) model.TokenResponse {
+	resp := postJSON(t, ts.URL+"/auth/login", map[string]string{
+		"email":    email,
+		"password": plainPassword,
+	})
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK on login; got %v", resp.StatusCode)
+	}
+
+	var tokenResponse model.TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+	return tokenResponse
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ts, cleanup := runTestServer()
+	defer cleanup()
+
+	createActivatedUser(t, "refresh@example.com", "password", RoleStudent)
+	tokens := login(t, ts, "refresh@example.com", "password")
+	if tokens.Token == "" || tokens.RefreshToken == "" {
+		t.Fatalf("Expected access and refresh tokens on login")
+	}
+
+	// First use of the refresh token rotates it
+	resp := postJSON(t, ts.URL+"/auth/refresh", model.RefreshRequest{RefreshToken: tokens.RefreshToken})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK; got %v", resp.StatusCode)
+	}
+
+	var rotated model.TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rotated); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("Expected a new refresh token")
+	}
+
+	// Replaying the old token is rejected
+	resp = postJSON(t, ts.URL+"/auth/refresh", model.RefreshRequest{RefreshToken: tokens.RefreshToken})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status Unauthorized on reuse; got %v", resp.StatusCode)
+	}
+
+	// ...and revokes the rest of the family
+	resp = postJSON(t, ts.URL+"/auth/refresh", model.RefreshRequest{RefreshToken: rotated.RefreshToken})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status Unauthorized after family revocation; got %v", resp.StatusCode)
+	}
+}
+
+func doWithToken(t *testing.T, method, url, token string, body interface{}) *http.Response {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("Could not encode body: %v", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Could not send request: %v", err)
+	}
+	return resp
+}
+
+func TestLogoutRevokesToken(t *testing.T) {
+	ts, cleanup := runTestServer()
+	defer cleanup()
+
+	createActivatedUser(t, "logout@example.com", "password", RoleStudent)
+	tokens := login(t, ts, "logout@example.com", "password")
+
+	resp := doWithToken(t, "POST", ts.URL+"/auth/logout", tokens.Token, model.RefreshRequest{RefreshToken: tokens.RefreshToken})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK; got %v", resp.StatusCode)
+	}
+
+	resp = doWithToken(t, "GET", ts.URL+"/auth/validate-token", tokens.Token, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status Unauthorized for revoked token; got %v", resp.StatusCode)
+	}
+
+	resp = postJSON(t, ts.URL+"/auth/refresh", model.RefreshRequest{RefreshToken: tokens.RefreshToken})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status Unauthorized for revoked refresh token; got %v", resp.StatusCode)
+	}
+}
+
+func TestLogoutAllRevokesEverySession(t *testing.T) {
+	ts, cleanup := runTestServer()
+	defer cleanup()
+
+	createActivatedUser(t, "logoutall@example.com", "password", RoleStudent)
+	first := login(t, ts, "logoutall@example.com", "password")
+	second := login(t, ts, "logoutall@example.com", "password")
+
+	resp := doWithToken(t, "POST", ts.URL+"/auth/logout-all", first.Token, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK; got %v", resp.StatusCode)
+	}
+
+	resp = doWithToken(t, "GET", ts.URL+"/auth/validate-token", second.Token, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status Unauthorized for other session; got %v", resp.StatusCode)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	ts, cleanup := runTestServer()
+	defer cleanup()
+
+	user := createActivatedUser(t, "reset@example.com", "password", RoleStudent)
+	tokens := login(t, ts, "reset@example.com", "password")
+
+	resp := postJSON(t, ts.URL+"/auth/password/forgot", model.ForgotPasswordRequest{Email: "reset@example.com"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK; got %v", resp.StatusCode)
+	}
+
+	// The token itself only travels by email, so plant a known one
+	resetToken := "known-reset-token"
+	stored := data.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(resetToken),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	if err := db.Create(&stored).Error; err != nil {
+		t.Fatalf("Could not create reset token: %v", err)
+	}
+
+	resp = postJSON(t, ts.URL+"/auth/password/reset", model.ResetPasswordRequest{Token: resetToken, Password: "new-password"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK; got %v", resp.StatusCode)
+	}
+
+	// The token is single-use
+	resp = postJSON(t, ts.URL+"/auth/password/reset", model.ResetPasswordRequest{Token: resetToken, Password: "other-password"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected status Bad Request on reuse; got %v", resp.StatusCode)
+	}
+
+	// Existing sessions are revoked
+	resp = doWithToken(t, "GET", ts.URL+"/auth/validate-token", tokens.Token, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status Unauthorized for old session; got %v", resp.StatusCode)
+	}
+
+	login(t, ts, "reset@example.com", "new-password")
+}
+
+func TestChangePassword(t *testing.T) {
+	ts, cleanup := runTestServer()
+	defer cleanup()
+
+	createActivatedUser(t, "change@example.com", "password", RoleStudent)
+	tokens := login(t, ts, "change@example.com", "password")
+
+	resp := doWithToken(t, "PUT", ts.URL+"/auth/api/password", tokens.Token, model.ChangePasswordRequest{
+		CurrentPassword: "wrong-password",
+		NewPassword:     "new-password",
+	})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected status Forbidden for wrong current password; got %v", resp.StatusCode)
+	}
+
+	resp = doWithToken(t, "PUT", ts.URL+"/auth/api/password", tokens.Token, model.ChangePasswordRequest{
+		CurrentPassword: "password",
+		NewPassword:     "new-password",
+	})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK; got %v", resp.StatusCode)
+	}
+
+	login(t, ts, "change@example.com", "new-password")
+}
+
+func TestChangeEmailRequiresConfirmation(t *testing.T) {
+	ts, cleanup := runTestServer()
+	defer cleanup()
+
+	user := createActivatedUser(t, "old@example.com", "password", RoleStudent)
+	tokens := login(t, ts, "old@example.com", "password")
+
+	resp := doWithToken(t, "POST", ts.URL+"/auth/api/email", tokens.Token, model.ChangeEmailRequest{
+		NewEmail: "new@example.com",
+		Password: "password",
+	})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected status Accepted; got %v", resp.StatusCode)
+	}
+
+	// Nothing changes until the link is followed
+	if err := db.First(&user, user.ID).Error; err != nil {
+		t.Fatalf("Could not find user in database: %v", err)
+	}
+	if user.Email != "old@example.com" {
+		t.Fatalf("Expected email to stay unchanged before confirmation; got %v", user.Email)
+	}
+
+	// Replace the emailed token with a known one
+	confirmToken := "known-confirm-token"
+	if err := db.Model(&data.EmailChangeRequest{}).Where("user_id = ?", user.ID).Update("token_hash", hashToken(confirmToken)).Error; err != nil {
+		t.Fatalf("Could not update email change request: %v", err)
+	}
+
+	resp, err := http.Get(ts.URL + "/auth/email/confirm/" + confirmToken)
+	if err != nil {
+		t.Fatalf("Could not send request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK; got %v", resp.StatusCode)
+	}
+
+	if err := db.First(&user, user.ID).Error; err != nil {
+		t.Fatalf("Could not find user in database: %v", err)
+	}
+	if user.Email != "new@example.com" {
+		t.Fatalf("Expected email to be changed; got %v", user.Email)
+	}
+}
+
+func TestJWKSAndKeyRotation(t *testing.T) {
+	ts, cleanup := runTestServer()
+	defer cleanup()
+
+	createActivatedUser(t, "jwks@example.com", "password", RoleStudent)
+	tokens := login(t, ts, "jwks@example.com", "password")
+
+	token, _, err := new(jwt.Parser).ParseUnverified(tokens.Token, &model.Claims{})
+	if err != nil {
+		t.Fatalf("Could not parse token: %v", err)
+	}
+	if token.Method != jwt.SigningMethodRS256 {
+		t.Fatalf("Expected RS256 token; got %v", token.Method.Alg())
+	}
+	kid, _ := token.Header["kid"].(string)
+
+	if err := rotateSigningKey(); err != nil {
+		t.Fatalf("Could not rotate signing key: %v", err)
+	}
+
+	resp, err := http.Get(ts.URL + "/.well-known/jwks.json")
+	if err != nil {
+		t.Fatalf("Could not send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("Expected old and new key during overlap; got %d keys", len(jwks.Keys))
+	}
+	if jwks.Keys[1].Kid != kid {
+		t.Fatalf("Expected retired key %s to still be published", kid)
+	}
+
+	// Tokens signed before the rotation stay valid
+	resp = doWithToken(t, "GET", ts.URL+"/auth/validate-token", tokens.Token, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK for token signed with retired key; got %v", resp.StatusCode)
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	ts, cleanup := runTestServer()
+	defer cleanup()
+
+	createActivatedUser(t, "totp@example.com", "password", RoleStudent)
+	tokens := login(t, ts, "totp@example.com", "password")
+
+	resp := doWithToken(t, "POST", ts.URL+"/auth/api/2fa/enroll", tokens.Token, nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK; got %v", resp.StatusCode)
+	}
+	var enrollment model.TwoFactorEnrollResponse
+	if err := json.NewDecoder(resp.Body).Decode(&enrollment); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+
+	step := time.Now().Unix() / totpPeriod
+	code, err := totpCode(enrollment.Secret, step)
+	if err != nil {
+		t.Fatalf("Could not compute code: %v", err)
+	}
+	resp = doWithToken(t, "POST", ts.URL+"/auth/api/2fa/enable", tokens.Token, model.TwoFactorCodeRequest{Code: code})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK; got %v", resp.StatusCode)
+	}
+	var recovery model.RecoveryCodesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&recovery); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+	if len(recovery.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes; got %d", recoveryCodeCount, len(recovery.RecoveryCodes))
+	}
+
+	// Password alone now only yields a challenge
+	resp = postJSON(t, ts.URL+"/auth/login", map[string]string{"email": "totp@example.com", "password": "password"})
+	defer resp.Body.Close()
+	var challenge model.TwoFactorChallengeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&challenge); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+	if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("Expected a two-factor challenge")
+	}
+
+	// The code used for enrollment cannot be replayed
+	resp = postJSON(t, ts.URL+"/auth/login/2fa", model.TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, Code: code})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status Unauthorized for replayed code; got %v", resp.StatusCode)
+	}
+
+	resp = postJSON(t, ts.URL+"/auth/login/2fa", model.TwoFactorLoginRequest{ChallengeToken: challenge.ChallengeToken, RecoveryCode: recovery.RecoveryCodes[0]})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK with recovery code; got %v", resp.StatusCode)
+	}
+	var completed model.TokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completed); err != nil {
+		t.Fatalf("Could not decode response: %v", err)
+	}
+	if completed.Token == "" {
+		t.Fatalf("Expected an access token after the second factor")
+	}
+}
+
+func TestLoginBackoffAndGenericErrors(t *testing.T) {
+	ts, cleanup := runTestServer()
+	defer cleanup()
+
+	createActivatedUser(t, "throttle@example.com", "password", RoleStudent)
+
+	readBody := func(resp *http.Response) string {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Could not read body: %v", err)
+		}
+		return string(body)
+	}
+
+	unknown := readBody(postJSON(t, ts.URL+"/auth/login", map[string]string{"email": "nobody@example.com", "password": "password"}))
+	wrong := readBody(postJSON(t, ts.URL+"/auth/login", map[string]string{"email": "throttle@example.com", "password": "wrong"}))
+	if unknown != wrong {
+		t.Fatalf("Expected the same error for unknown accounts and wrong passwords; got %q and %q", unknown, wrong)
+	}
+
+	for i := 0; i < accountThrottle.freeAttempts; i++ {
+		resp := postJSON(t, ts.URL+"/auth/login", map[string]string{"email": "throttle@example.com", "password": "wrong"})
+		resp.Body.Close()
+	}
+
+	// Even the right password has to wait for the backoff to pass
+	resp := postJSON(t, ts.URL+"/auth/login", map[string]string{"email": "throttle@example.com", "password": "password"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected status Too Many Requests; got %v", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("Expected a Retry-After header")
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	ts, cleanup := runTestServer()
+	defer cleanup()
+
+	createActivatedUser(t, "admin@example.com", "password", RoleAdmin)
+	createActivatedUser(t, "instructor@example.com", "password", RoleInstructor)
+	adminToken := login(t, ts, "admin@example.com", "password").Token
+	instructorToken := login(t, ts, "instructor@example.com", "password").Token
+
+	resp := doWithToken(t, "GET", ts.URL+"/auth/api/auth/users", instructorToken, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Expected status Forbidden without user:read; got %v", resp.StatusCode)
+	}
+
+	resp = doWithToken(t, "PUT", ts.URL+"/auth/api/auth/admin/roles/instructor", adminToken, model.RolePermissionsRequest{Permissions: []string{"user:read"}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected status No Content; got %v", resp.StatusCode)
+	}
+
+	// The old token is outdated once the role changed
+	resp = doWithToken(t, "GET", ts.URL+"/auth/api/auth/users", instructorToken, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status Unauthorized for outdated token; got %v", resp.StatusCode)
+	}
+
+	instructorToken = login(t, ts, "instructor@example.com", "password").Token
+	resp = doWithToken(t, "GET", ts.URL+"/auth/api/auth/users", instructorToken, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK with user:read; got %v", resp.StatusCode)
+	}
+
+	resp = doWithToken(t, "PUT", ts.URL+"/auth/api/auth/admin/roles/instructor", adminToken, model.RolePermissionsRequest{Permissions: []string{"no:such"}})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected status Bad Request for unknown permission; got %v", resp.StatusCode)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"assignment1/internal/data"
+	"assignment1/internal/model"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"lms-shared/events"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	errEmailTaken              = errors.New("email already exists")
+	errEmailChangeInvalid      = errors.New("email change link is invalid or expired")
+	errEmailChangeInvalidInput = errors.New("invalid email")
+)
+
+// startEmailChange records a pending change of the user's email. The new
+// address receives a confirmation link, the current one a security notice.
+func startEmailChange(user data.UserInfo, newEmail string) error {
+	newEmail = strings.TrimSpace(newEmail)
+	if !strings.Contains(newEmail, "@") {
+		return errEmailChangeInvalidInput
+	}
+
+	var count int64
+	if err := db.Model(&data.UserInfo{}).Where("email = ?", newEmail).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errEmailTaken
+	}
+
+	confirmToken, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND confirmed_at IS NULL", user.ID).Delete(&data.EmailChangeRequest{}).Error; err != nil {
+			return err
+		}
+
+		changeRequest := data.EmailChangeRequest{
+			UserID:    user.ID,
+			NewEmail:  newEmail,
+			TokenHash: hashToken(confirmToken),
+			ExpiresAt: time.Now().Add(emailChangeExpiresIn),
+		}
+		return tx.Create(&changeRequest).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// Отправка ссылки подтверждения на новый адрес
+	if err := PublishEvent(newEmail, user.PreferredLanguage, events.EmailConfirmationRequested{ConfirmToken: confirmToken}); err != nil {
+		log.Printf("Failed to send email confirmation to queue: %v", err)
+	}
+
+	// Уведомление на старый адрес
+	if err := PublishEvent(user.Email, user.PreferredLanguage, events.EmailChangeRequested{NewEmail: newEmail}); err != nil {
+		log.Printf("Failed to send email change notice to queue: %v", err)
+	}
+	return nil
+}
+
+// writeEmailChangeError maps an error from startEmailChange to an HTTP response.
+func writeEmailChangeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errEmailChangeInvalidInput):
+		http.Error(w, "Invalid email", http.StatusBadRequest)
+		log.Printf("Invalid email: %v", err)
+	case errors.Is(err, errEmailTaken):
+		http.Error(w, "Email already exists", http.StatusConflict)
+		log.Printf("Email already exists: %v", err)
+	default:
+		http.Error(w, "Failed to start email change", http.StatusInternalServerError)
+		log.Printf("Failed to start email change: %v", err)
+	}
+}
+
+func ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r)
+
+	var changeRequest model.ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&changeRequest); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		log.Printf("Invalid input: %v", err)
+		return
+	}
+
+	var user data.UserInfo
+	if err := db.First(&user, claims.UserId).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		log.Printf("User not found: %v", err)
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(changeRequest.Password)); err != nil {
+		http.Error(w, "Incorrect password", http.StatusForbidden)
+		log.Printf("Incorrect password for user %d", user.ID)
+		return
+	}
+
+	if err := startEmailChange(user, changeRequest.NewEmail); err != nil {
+		writeEmailChangeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Confirmation link sent to the new email"})
+}
+
+func ConfirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	confirmToken := mux.Vars(r)["token"]
+
+	var user data.UserInfo
+	var oldEmail string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var changeRequest data.EmailChangeRequest
+		if err := tx.Where("token_hash = ?", hashToken(confirmToken)).First(&changeRequest).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errEmailChangeInvalid
+			}
+			return err
+		}
+		if time.Now().After(changeRequest.ExpiresAt) {
+			return errEmailChangeInvalid
+		}
+
+		result := tx.Model(&data.EmailChangeRequest{}).
+			Where("id = ? AND confirmed_at IS NULL", changeRequest.ID).
+			Update("confirmed_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errEmailChangeInvalid
+		}
+
+		// Someone may have registered the address after the change was requested.
+		var count int64
+		if err := tx.Model(&data.UserInfo{}).Where("email = ?", changeRequest.NewEmail).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errEmailTaken
+		}
+
+		if err := tx.First(&user, changeRequest.UserID).Error; err != nil {
+			return err
+		}
+		oldEmail = user.Email
+		if err := tx.Model(&user).Update("email", changeRequest.NewEmail).Error; err != nil {
+			return err
+		}
+		user.Email = changeRequest.NewEmail
+
+		// Issued tokens still carry the old address.
+		return revokeAllUserSessions(tx, user.ID)
+	})
+	if errors.Is(err, errEmailChangeInvalid) {
+		http.Error(w, "Email change link not found", http.StatusNotFound)
+		log.Printf("Email change link not found: %v", err)
+		return
+	}
+	if errors.Is(err, errEmailTaken) {
+		http.Error(w, "Email already exists", http.StatusConflict)
+		log.Printf("Email already exists: %v", err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to change email", http.StatusInternalServerError)
+		log.Printf("Failed to change email: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email changed successfully"})
+
+	// Уведомление на старый адрес о смене почты
+	if err := PublishEvent(oldEmail, user.PreferredLanguage, events.EmailChanged{NewEmail: user.Email}); err != nil {
+		log.Printf("Failed to send email change notice to queue: %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"assignment1/internal/data"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const signingKeyBits = 2048
+
+type signingKey struct {
+	kid        string
+	privateKey *rsa.PrivateKey
+	createdAt  time.Time
+	retiredAt  *time.Time
+}
+
+// keyRing holds the key currently used for signing together with recently
+// retired keys, which stay valid for verification during the overlap window
+// so tokens signed before a rotation keep working until they expire.
+type keyRing struct {
+	mu     sync.RWMutex
+	active *signingKey
+	keys   map[string]*signingKey
+}
+
+var signingKeys = &keyRing{keys: make(map[string]*signingKey)}
+
+func (k *keyRing) current() (*signingKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.active == nil {
+		return nil, errors.New("no active signing key")
+	}
+	return k.active, nil
+}
+
+func (k *keyRing) publicKey(kid string) (*rsa.PublicKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, false
+	}
+	if key.retiredAt != nil && time.Since(*key.retiredAt) > keyOverlapWindow {
+		return nil, false
+	}
+	return &key.privateKey.PublicKey, true
+}
+
+func (k *keyRing) all() []*signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	keys := make([]*signingKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		if key.retiredAt != nil && time.Since(*key.retiredAt) > keyOverlapWindow {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].createdAt.After(keys[j].createdAt) })
+	return keys
+}
+
+// keyFunc resolves the verification key of a token by its kid header. Only
+// RSA signatures are accepted, so a token cannot pick a weaker algorithm.
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	publicKey, ok := signingKeys.publicKey(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return publicKey, nil
+}
+
+// signToken signs claims with the active key and sets the kid header.
+func signToken(claims jwt.Claims) (string, error) {
+	key, err := signingKeys.current()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.privateKey)
+}
+
+func createSigningKey(tx *gorm.DB) error {
+	privateKey, err := rsa.GenerateKey(rand.Reader, signingKeyBits)
+	if err != nil {
+		return err
+	}
+
+	stored := data.SigningKey{
+		Kid: uuid.New().String(),
+		PrivateKey: pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+		}),
+	}
+	return tx.Create(&stored).Error
+}
+
+// loadSigningKeys reads all keys that are still usable from the database. A
+// key is generated when none is active yet, e.g. on the first start.
+func loadSigningKeys() error {
+	var stored []data.SigningKey
+	if err := db.Where("retired_at IS NULL OR retired_at > ?", time.Now().Add(-keyOverlapWindow)).
+		Order("created_at").Find(&stored).Error; err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey, len(stored))
+	var active *signingKey
+	for _, s := range stored {
+		block, _ := pem.Decode(s.PrivateKey)
+		if block == nil {
+			return fmt.Errorf("signing key %s is not PEM encoded", s.Kid)
+		}
+		privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse signing key %s: %w", s.Kid, err)
+		}
+
+		key := &signingKey{kid: s.Kid, privateKey: privateKey, createdAt: s.CreatedAt, retiredAt: s.RetiredAt}
+		keys[s.Kid] = key
+		if s.RetiredAt == nil {
+			active = key
+		}
+	}
+
+	if active == nil {
+		if err := createSigningKey(db); err != nil {
+			return fmt.Errorf("failed to create signing key: %w", err)
+		}
+		return loadSigningKeys()
+	}
+
+	signingKeys.mu.Lock()
+	signingKeys.keys = keys
+	signingKeys.active = active
+	signingKeys.mu.Unlock()
+	return nil
+}
+
+// rotateSigningKey retires the active key and starts signing with a new one.
+func rotateSigningKey() error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&data.SigningKey{}).Where("retired_at IS NULL").
+			Update("retired_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return createSigningKey(tx)
+	})
+	if err != nil {
+		return err
+	}
+	return loadSigningKeys()
+}
+
+// startKeyRotation rotates the signing key once it gets older than
+// keyRotationInterval and reloads the key ring, so several instances of the
+// service pick up each other's rotations. Keys past the overlap window are
+// removed.
+func startKeyRotation(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			key, err := signingKeys.current()
+			if err == nil && time.Since(key.createdAt) > keyRotationInterval {
+				err = rotateSigningKey()
+			} else {
+				err = loadSigningKeys()
+			}
+			if err != nil {
+				log.Printf("Failed to refresh signing keys: %v", err)
+			}
+
+			if err := db.Where("retired_at < ?", time.Now().Add(-keyOverlapWindow)).Delete(&data.SigningKey{}).Error; err != nil {
+				log.Printf("Failed to delete expired signing keys: %v", err)
+			}
+		}
+	}()
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	keys := signingKeys.all()
+	jwks := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{Keys: make([]jsonWebKey, 0, len(keys))}
+
+	for _, key := range keys {
+		publicKey := key.privateKey.PublicKey
+		jwks.Keys = append(jwks.Keys, jsonWebKey{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: jwt.SigningMethodRS256.Alg(),
+			Kid: key.kid,
+			N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+		})
+	}
+
+	jsonResponse, err := json.Marshal(jwks)
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		log.Printf("Failed to marshal response: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+func RotateKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if err := rotateSigningKey(); err != nil {
+		http.Error(w, "Failed to rotate signing key", http.StatusInternalServerError)
+		log.Printf("Failed to rotate signing key: %v", err)
+		return
+	}
+
+	key, err := signingKeys.current()
+	if err != nil {
+		http.Error(w, "Failed to rotate signing key", http.StatusInternalServerError)
+		log.Printf("Failed to rotate signing key: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Signing key rotated", "kid": key.kid})
+}
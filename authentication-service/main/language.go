@@ -0,0 +1,59 @@
+package main
+
+import (
+	"assignment1/internal/data"
+	"assignment1/internal/model"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var errInvalidLanguage = errors.New("preferred language must be a language tag such as en or ru")
+
+var languageTag = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+// normalizeLanguage lower-cases a language tag such as "ru-RU". An empty tag
+// is allowed and leaves the choice to the notification service.
+func normalizeLanguage(tag string) (string, error) {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if tag != "" && !languageTag.MatchString(tag) {
+		return "", errInvalidLanguage
+	}
+	return tag, nil
+}
+
+// UpdateLanguageHandler sets the language notifications are sent in. Tokens
+// pick up the new language when they are next refreshed.
+func UpdateLanguageHandler(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r)
+
+	var languageRequest model.UpdateLanguageRequest
+	if err := json.NewDecoder(r.Body).Decode(&languageRequest); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		log.Printf("Invalid input: %v", err)
+		return
+	}
+
+	language, err := normalizeLanguage(languageRequest.PreferredLanguage)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := db.Model(&data.UserInfo{}).Where("id = ?", claims.UserId).Update("preferred_language", language)
+	if result.Error != nil {
+		http.Error(w, "Failed to update language", http.StatusInternalServerError)
+		log.Printf("Failed to update language: %v", result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model.UpdateLanguageRequest{PreferredLanguage: language})
+}
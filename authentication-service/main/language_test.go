@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestNormalizeLanguage(t *testing.T) {
+	valid := map[string]string{
+		"":        "",
+		"ru":      "ru",
+		" EN ":    "en",
+		"ru_RU":   "ru-ru",
+		"pt-BR":   "pt-br",
+		"zh-Hant": "zh-hant",
+	}
+	for tag, expected := range valid {
+		got, err := normalizeLanguage(tag)
+		if err != nil || got != expected {
+			t.Errorf("normalizeLanguage(%q) = %q, %v; expected %q", tag, got, err, expected)
+		}
+	}
+
+	for _, tag := range []string{"english", "r", "ru-", "<ru>"} {
+		if _, err := normalizeLanguage(tag); err != errInvalidLanguage {
+			t.Errorf("normalizeLanguage(%q) = %v; expected errInvalidLanguage", tag, err)
+		}
+	}
+}
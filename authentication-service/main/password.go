@@ -0,0 +1,233 @@
+package main
+
+import (
+	"assignment1/internal/data"
+	"assignment1/internal/model"
+	"encoding/json"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"lms-shared/events"
+	"log"
+	"net/http"
+	"time"
+)
+
+const minPasswordLength = 8
+
+var errResetTokenInvalid = errors.New("reset token is invalid or expired")
+
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var forgotRequest model.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&forgotRequest); err != nil || forgotRequest.Email == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		log.Printf("Invalid input: %v", err)
+		return
+	}
+
+	// The response is the same whether or not the email is registered, so
+	// the endpoint cannot be used to discover accounts.
+	jsonResponse, err := json.Marshal(map[string]string{"message": "If the email is registered, a password reset link has been sent"})
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		log.Printf("Failed to marshal response: %v", err)
+		return
+	}
+
+	var user data.UserInfo
+	if err := db.Where("email = ?", forgotRequest.Email).First(&user).Error; err == nil {
+		if err := sendPasswordResetToken(user); err != nil {
+			http.Error(w, "Failed to create password reset token", http.StatusInternalServerError)
+			log.Printf("Failed to create password reset token: %v", err)
+			return
+		}
+	} else {
+		log.Printf("Password reset requested for unknown email: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// sendPasswordResetToken replaces any pending reset tokens of the user with a
+// new one and mails it through the notification queue.
+func sendPasswordResetToken(user data.UserInfo) error {
+	resetToken, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&data.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+
+		stored := data.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: hashToken(resetToken),
+			ExpiresAt: time.Now().Add(passwordResetExpiresIn),
+		}
+		return tx.Create(&stored).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// Отправка сообщения на почту
+	if err := PublishEvent(user.Email, user.PreferredLanguage, events.PasswordResetRequested{ResetToken: resetToken}); err != nil {
+		log.Printf("Failed to send password reset email to queue: %v", err)
+	}
+	return nil
+}
+
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var resetRequest model.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&resetRequest); err != nil || resetRequest.Token == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		log.Printf("Invalid input: %v", err)
+		return
+	}
+
+	if len(resetRequest.Password) < minPasswordLength {
+		http.Error(w, "Password is too short", http.StatusBadRequest)
+		log.Println("Password is too short")
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(resetRequest.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		log.Printf("Failed to hash password: %v", err)
+		return
+	}
+
+	var user data.UserInfo
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var stored data.PasswordResetToken
+		if err := tx.Where("token_hash = ?", hashToken(resetRequest.Token)).First(&stored).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errResetTokenInvalid
+			}
+			return err
+		}
+		if time.Now().After(stored.ExpiresAt) {
+			return errResetTokenInvalid
+		}
+
+		// Claim the token atomically so it can only ever be used once.
+		result := tx.Model(&data.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errResetTokenInvalid
+		}
+
+		if err := tx.First(&user, stored.UserID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("password_hash", hashedPassword).Error; err != nil {
+			return err
+		}
+
+		return revokeAllUserSessions(tx, user.ID)
+	})
+	if errors.Is(err, errResetTokenInvalid) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		log.Printf("Invalid reset token: %v", err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		log.Printf("Failed to reset password: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password reset successfully"})
+
+	// Отправка сообщения на почту о смене пароля
+	if err := PublishEvent(user.Email, user.PreferredLanguage, events.PasswordChanged{}); err != nil {
+		log.Printf("Failed to send password change email to queue: %v", err)
+	}
+}
+
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r)
+
+	var changeRequest model.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&changeRequest); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		log.Printf("Invalid input: %v", err)
+		return
+	}
+
+	if len(changeRequest.NewPassword) < minPasswordLength {
+		http.Error(w, "Password is too short", http.StatusBadRequest)
+		log.Println("Password is too short")
+		return
+	}
+
+	var user data.UserInfo
+	if err := db.First(&user, claims.UserId).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		log.Printf("User not found: %v", err)
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(changeRequest.CurrentPassword)); err != nil {
+		http.Error(w, "Incorrect password", http.StatusForbidden)
+		log.Printf("Incorrect current password for user %d", user.ID)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(changeRequest.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		log.Printf("Failed to hash password: %v", err)
+		return
+	}
+
+	// Every other session is signed out, the caller gets a fresh token pair.
+	var tokenResponse model.TokenResponse
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password_hash", hashedPassword).Error; err != nil {
+			return err
+		}
+		if err := revokeAllUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.First(&user, user.ID).Error; err != nil {
+			return err
+		}
+
+		var err error
+		tokenResponse, err = issueTokenPair(tx, user, "")
+		return err
+	})
+	if err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		log.Printf("Failed to change password: %v", err)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(tokenResponse)
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		log.Printf("Failed to marshal response: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+
+	// Отправка сообщения на почту о смене пароля
+	if err := PublishEvent(user.Email, user.PreferredLanguage, events.PasswordChanged{}); err != nil {
+		log.Printf("Failed to send password change email to queue: %v", err)
+	}
+}
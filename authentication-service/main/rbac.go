@@ -0,0 +1,201 @@
+package main
+
+import (
+	"assignment1/internal/data"
+	"assignment1/internal/model"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const (
+	RoleStudent    = "STUDENT"
+	RoleInstructor = "INSTRUCTOR"
+	RoleAdmin      = "ADMIN"
+)
+
+// defaultRolePermissions are granted to the built-in roles on every start, so
+// new permissions reach existing installations. Administrators can grant
+// more through the roles API, but not take these away.
+var defaultRolePermissions = map[string][]string{
+	RoleStudent: {
+		"course:read",
+	},
+	RoleInstructor: {
+		"course:read", "course:write", "course:delete",
+	},
+	RoleAdmin: {
+		"course:read", "course:write", "course:delete", "course:manage", "course:publish",
+		"user:read", "user:write", "user:delete",
+		"role:manage", "key:rotate", "notification:manage",
+	},
+}
+
+var errUnknownPermission = errors.New("unknown permission")
+
+// ensureDefaultRoles creates the built-in roles and permissions if they are
+// missing and grants the default permissions.
+func ensureDefaultRoles() error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for roleName, permissionNames := range defaultRolePermissions {
+			role := data.Role{Name: roleName}
+			if err := tx.Where("name = ?", roleName).FirstOrCreate(&role).Error; err != nil {
+				return err
+			}
+
+			permissions := make([]data.Permission, len(permissionNames))
+			for i, name := range permissionNames {
+				permissions[i] = data.Permission{Name: name}
+				if err := tx.Where("name = ?", name).FirstOrCreate(&permissions[i]).Error; err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Model(&role).Association("Permissions").Append(permissions); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// permissionsForRole returns the names of the permissions granted to role.
+func permissionsForRole(roleName string) ([]string, error) {
+	var permissions []string
+	err := db.Table("permissions").
+		Select("permissions.name").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.name = ?", roleName).
+		Order("permissions.name").
+		Pluck("permissions.name", &permissions).Error
+	return permissions, err
+}
+
+func roleExists(roleName string) (bool, error) {
+	var count int64
+	err := db.Model(&data.Role{}).Where("name = ?", roleName).Count(&count).Error
+	return count > 0, err
+}
+
+func hasPermission(claims *model.Claims, permission string) bool {
+	for _, p := range claims.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission only lets requests through whose token grants
+// permission. It has to run after AuthMiddleware.
+func RequirePermission(permission string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := claimsFromContext(r)
+			if claims == nil || !hasPermission(claims, permission) {
+				http.Error(w, "Unauthorized", http.StatusForbidden)
+				log.Printf("Unauthorized access attempt, missing permission %s", permission)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func getAllRolesHandler(w http.ResponseWriter, r *http.Request) {
+	var roles []data.Role
+	if err := db.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		http.Error(w, "Failed to fetch roles", http.StatusInternalServerError)
+		log.Printf("Failed to fetch roles: %v", err)
+		return
+	}
+
+	var rolesResponse []map[string]interface{}
+	for _, role := range roles {
+		permissions := make([]string, 0, len(role.Permissions))
+		for _, p := range role.Permissions {
+			permissions = append(permissions, p.Name)
+		}
+		sort.Strings(permissions)
+
+		rolesResponse = append(rolesResponse, map[string]interface{}{
+			"Name":        role.Name,
+			"Permissions": permissions,
+		})
+	}
+
+	jsonResponse, err := json.Marshal(rolesResponse)
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		log.Printf("Failed to marshal response: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+// updateRolePermissionsHandler replaces the permissions of a role, creating
+// the role if it does not exist yet. Built-in roles keep their defaults.
+func updateRolePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	roleName := strings.ToUpper(mux.Vars(r)["name"])
+
+	var permissionsRequest model.RolePermissionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&permissionsRequest); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		log.Printf("Invalid input: %v", err)
+		return
+	}
+
+	names := append(permissionsRequest.Permissions, defaultRolePermissions[roleName]...)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var permissions []data.Permission
+		if err := tx.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+			return err
+		}
+		found := make(map[string]bool, len(permissions))
+		for _, p := range permissions {
+			found[p.Name] = true
+		}
+		for _, name := range names {
+			if !found[name] {
+				return fmt.Errorf("%w: %s", errUnknownPermission, name)
+			}
+		}
+
+		role := data.Role{Name: roleName}
+		if err := tx.Where("name = ?", roleName).FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&role).Association("Permissions").Replace(permissions); err != nil {
+			return err
+		}
+
+		// Access tokens embed the permissions. Outdating them makes clients
+		// fetch new ones through their refresh tokens.
+		return tx.Model(&data.UserInfo{}).Where("user_role = ?", roleName).
+			Update("token_version", gorm.Expr("token_version + 1")).Error
+	})
+	if errors.Is(err, errUnknownPermission) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		log.Printf("Invalid input: %v", err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update role", http.StatusInternalServerError)
+		log.Printf("Failed to update role: %v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"assignment1/internal/data"
+	"assignment1/internal/model"
+	"encoding/json"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	errMissingAuthHeader = errors.New("missing Authorization header")
+	errInvalidToken      = errors.New("invalid token")
+	errTokenRevoked      = errors.New("token has been revoked")
+)
+
+// parseRequestToken extracts the bearer token from the request, verifies its
+// signature and expiry and rejects it if it has been revoked.
+func parseRequestToken(r *http.Request) (*model.Claims, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, errMissingAuthHeader
+	}
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+	claims := &model.Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, keyFunc)
+	if err != nil || !token.Valid {
+		return nil, errInvalidToken
+	}
+
+	revoked, err := isTokenRevoked(claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// writeTokenError maps an error from parseRequestToken to an HTTP response.
+func writeTokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errMissingAuthHeader):
+		http.Error(w, "Missing Authorization header", http.StatusUnauthorized)
+		log.Println("Missing Authorization header")
+	case errors.Is(err, errInvalidToken):
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		log.Printf("Invalid token: %v", err)
+	case errors.Is(err, errTokenRevoked):
+		http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+		log.Println("Revoked token used")
+	default:
+		http.Error(w, "Failed to validate token", http.StatusInternalServerError)
+		log.Printf("Failed to validate token: %v", err)
+	}
+}
+
+// isTokenRevoked reports whether the token was revoked individually by its
+// jti, or in bulk by bumping the user's token version. Tokens of deleted users
+// are treated as revoked as well.
+func isTokenRevoked(claims *model.Claims) (bool, error) {
+	if claims.Id != "" {
+		var count int64
+		if err := db.Model(&data.RevokedToken{}).Where("jti = ?", claims.Id).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+
+	var user data.UserInfo
+	err := db.Select("id", "token_version").First(&user, claims.UserId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return user.TokenVersion != claims.TokenVersion, nil
+}
+
+// revokeAllUserSessions invalidates every access and refresh token issued to
+// the user so far.
+func revokeAllUserSessions(tx *gorm.DB, userID uint) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&data.UserInfo{}).Where("id = ?", userID).
+			Update("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&data.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// startRevocationCleanup periodically removes revocation entries for tokens
+// that have expired anyway.
+func startRevocationCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := db.Where("expires_at < ?", time.Now()).Delete(&data.RevokedToken{}).Error; err != nil {
+				log.Printf("Failed to clean up revoked tokens: %v", err)
+			}
+		}
+	}()
+}
+
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	claims, err := parseRequestToken(r)
+	if err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	// The refresh token is optional; when given its family is revoked too.
+	var refreshRequest model.RefreshRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&refreshRequest); err != nil {
+			http.Error(w, "Invalid input", http.StatusBadRequest)
+			log.Printf("Invalid input: %v", err)
+			return
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if claims.Id != "" {
+			revoked := data.RevokedToken{
+				JTI:       claims.Id,
+				UserID:    claims.UserId,
+				ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+			}
+			if err := tx.Create(&revoked).Error; err != nil {
+				return err
+			}
+		}
+
+		if refreshRequest.RefreshToken != "" {
+			var stored data.RefreshToken
+			err := tx.Where("token_hash = ? AND user_id = ?", hashToken(refreshRequest.RefreshToken), claims.UserId).First(&stored).Error
+			if err == nil {
+				return revokeRefreshTokenFamily(tx, stored.FamilyID)
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		log.Printf("Failed to log out: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+}
+
+func LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	claims, err := parseRequestToken(r)
+	if err != nil {
+		writeTokenError(w, err)
+		return
+	}
+
+	if err := revokeAllUserSessions(db, claims.UserId); err != nil {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		log.Printf("Failed to revoke sessions of user %d: %v", claims.UserId, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out from all sessions"})
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"assignment1/internal/data"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"lms-shared/events"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// throttlePolicy describes how failed logins for one kind of key are
+// punished. The first freeAttempts failures are free, every further one
+// doubles the wait before the next attempt, and reaching lockoutThreshold
+// blocks the key for lockoutDuration. A zero lockoutThreshold never locks
+// the key out.
+type throttlePolicy struct {
+	prefix           string
+	freeAttempts     int
+	lockoutThreshold int
+	lockoutDuration  time.Duration
+}
+
+var (
+	accountThrottle = throttlePolicy{prefix: "account:", freeAttempts: 3, lockoutThreshold: 10, lockoutDuration: 30 * time.Minute}
+	ipThrottle      = throttlePolicy{prefix: "ip:", freeAttempts: 20, lockoutThreshold: 100, lockoutDuration: 30 * time.Minute}
+)
+
+const (
+	loginBackoffBase   = time.Second
+	maxLoginBackoff    = 15 * time.Minute
+	loginFailureWindow = time.Hour
+)
+
+// trustedProxies are the addresses allowed to report the client address in
+// X-Real-IP or X-Forwarded-For. They are read from TRUSTED_PROXIES, which has
+// to list the nginx address from docker-compose.yml; without it the headers
+// are ignored, since any caller can set them.
+var trustedProxies []*net.IPNet
+
+// parseTrustedProxies reads a comma-separated list of addresses and CIDR
+// ranges, such as "127.0.0.1,172.16.0.0/12".
+func parseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			entry = fmt.Sprintf("%s/%d", entry, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	for _, proxy := range trustedProxies {
+		if ip != nil && proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the caller. The forwarding headers are
+// only honoured when the request comes from a trusted proxy; X-Forwarded-For
+// is read from the right, skipping the trusted proxies in the chain.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(net.ParseIP(host)) {
+		return host
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		if !isTrustedProxy(ip) {
+			return ip.String()
+		}
+	}
+	return host
+}
+
+func accountThrottleKey(email string) string {
+	return accountThrottle.prefix + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return ipThrottle.prefix + ip
+}
+
+// currentIPThrottle is ipThrottle without the lockout while no trusted proxy
+// is configured. Behind a proxy that is not listed every user shares the
+// proxy's address, and a lockout of that address would keep everybody out.
+func currentIPThrottle() throttlePolicy {
+	policy := ipThrottle
+	if len(trustedProxies) == 0 {
+		policy.lockoutThreshold = 0
+	}
+	return policy
+}
+
+// loginRetryAfter returns how long the caller has to wait before the next
+// login attempt is accepted, or zero if it may try right away.
+func loginRetryAfter(keys ...string) (time.Duration, error) {
+	var throttles []data.LoginThrottle
+	if err := db.Where("key IN ? AND blocked_until > ?", keys, time.Now()).Find(&throttles).Error; err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, t := range throttles {
+		if d := time.Until(*t.BlockedUntil); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// recordFailure counts a failed attempt for key and reports whether the key
+// got locked out by it.
+func recordFailure(policy throttlePolicy, key string) (bool, error) {
+	locked := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&data.LoginThrottle{Key: key, LastFailureAt: time.Now()}).Error; err != nil {
+			return err
+		}
+
+		var throttle data.LoginThrottle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&throttle).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if now.Sub(throttle.LastFailureAt) > loginFailureWindow {
+			throttle.Failures = 0
+		}
+		throttle.Failures++
+		throttle.LastFailureAt = now
+
+		switch {
+		case policy.lockoutThreshold > 0 && throttle.Failures >= policy.lockoutThreshold:
+			blockedUntil := now.Add(policy.lockoutDuration)
+			throttle.BlockedUntil = &blockedUntil
+			locked = throttle.Failures == policy.lockoutThreshold
+		case throttle.Failures > policy.freeAttempts:
+			backoff := loginBackoffBase << uint(throttle.Failures-policy.freeAttempts-1)
+			if backoff > maxLoginBackoff {
+				backoff = maxLoginBackoff
+			}
+			blockedUntil := now.Add(backoff)
+			throttle.BlockedUntil = &blockedUntil
+		}
+
+		return tx.Save(&throttle).Error
+	})
+	return locked, err
+}
+
+// recordLoginFailure counts a failed login for the account and the caller's
+// address. The account owner is told by email when the account gets locked.
+func recordLoginFailure(email, ip string) {
+	if _, err := recordFailure(currentIPThrottle(), ipThrottleKey(ip)); err != nil {
+		log.Printf("Failed to record login failure for %s: %v", ip, err)
+	}
+
+	locked, err := recordFailure(accountThrottle, accountThrottleKey(email))
+	if err != nil {
+		log.Printf("Failed to record login failure for %s: %v", email, err)
+		return
+	}
+	if !locked {
+		return
+	}
+
+	log.Printf("Account %s locked after repeated failed logins", email)
+	var user data.UserInfo
+	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
+		return
+	}
+	// Отправка сообщения на почту о блокировке
+	if err := PublishEvent(user.Email, user.PreferredLanguage, events.AccountLocked{}); err != nil {
+		log.Printf("Failed to send lockout email to queue: %v", err)
+	}
+}
+
+// resetLoginFailures clears the failure count of an account after it logged
+// in successfully.
+func resetLoginFailures(email string) {
+	if err := db.Where("key = ?", accountThrottleKey(email)).Delete(&data.LoginThrottle{}).Error; err != nil {
+		log.Printf("Failed to reset login failures for %s: %v", email, err)
+	}
+}
+
+// writeThrottled responds to a login attempt that arrived too early.
+func writeThrottled(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(wait.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too many login attempts, try again later", http.StatusTooManyRequests)
+	log.Printf("Login attempt throttled for %d seconds", seconds)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPTrustsHeadersOnlyFromProxies(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.1, 172.16.0.0/12")
+	if err != nil {
+		t.Fatalf("Could not parse trusted proxies: %v", err)
+	}
+	trustedProxies = proxies
+	defer func() { trustedProxies = nil }()
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		realIP       string
+		forwardedFor string
+		expectedIP   string
+	}{
+		{"direct caller spoofing X-Real-IP", "203.0.113.5:4000", "198.51.100.1", "", "203.0.113.5"},
+		{"direct caller spoofing X-Forwarded-For", "203.0.113.5:4000", "", "198.51.100.1", "203.0.113.5"},
+		{"trusted proxy with X-Real-IP", "10.0.0.1:4000", "198.51.100.1", "", "198.51.100.1"},
+		{"trusted proxy chain", "172.17.0.2:4000", "", "198.51.100.7, 198.51.100.1, 172.18.0.3", "198.51.100.1"},
+		{"trusted proxy with garbage", "10.0.0.1:4000", "not-an-ip", "", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/auth/login", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if tt.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		if got := clientIP(r); got != tt.expectedIP {
+			t.Errorf("%s: expected %s; got %s", tt.name, tt.expectedIP, got)
+		}
+	}
+}
+
+func TestParseTrustedProxiesRejectsInvalidEntries(t *testing.T) {
+	if _, err := parseTrustedProxies("10.0.0.1,nginx"); err == nil {
+		t.Fatal("Expected an error for a host name")
+	}
+	if proxies, err := parseTrustedProxies(""); err != nil || len(proxies) != 0 {
+		t.Fatalf("Expected no proxies for an empty list; got %v, %v", proxies, err)
+	}
+}
+
+func TestIPThrottleLocksOutOnlyBehindTrustedProxies(t *testing.T) {
+	if policy := currentIPThrottle(); policy.lockoutThreshold != 0 {
+		t.Errorf("expected no IP lockout without trusted proxies; got threshold %d", policy.lockoutThreshold)
+	}
+
+	proxies, err := parseTrustedProxies("172.28.0.1")
+	if err != nil {
+		t.Fatalf("Could not parse trusted proxies: %v", err)
+	}
+	trustedProxies = proxies
+	defer func() { trustedProxies = nil }()
+
+	if policy := currentIPThrottle(); policy.lockoutThreshold != ipThrottle.lockoutThreshold {
+		t.Errorf("expected IP lockout after %d failures; got threshold %d", ipThrottle.lockoutThreshold, policy.lockoutThreshold)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"assignment1/internal/data"
+	"assignment1/internal/model"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"time"
+)
+
+var errRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// generateOpaqueToken returns a random URL-safe token. Only its hash is ever
+// stored, so a leaked database row cannot be replayed.
+func generateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokenPair signs an access token for the user and stores a new refresh
+// token in familyID. An empty familyID starts a new family, as on login.
+func issueTokenPair(tx *gorm.DB, user data.UserInfo, familyID string) (model.TokenResponse, error) {
+	accessToken, err := GenerateToken(user.ID, user.FName, user.Email, user.Activated, user.UserRole, user.TokenVersion, user.PreferredLanguage)
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+
+	refreshToken, err := generateOpaqueToken()
+	if err != nil {
+		return model.TokenResponse{}, err
+	}
+
+	if familyID == "" {
+		familyID = uuid.New().String()
+	}
+
+	stored := data.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(refreshToken),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(refreshTokenExpiresIn),
+	}
+	if err := tx.Create(&stored).Error; err != nil {
+		return model.TokenResponse{}, err
+	}
+
+	return model.TokenResponse{Token: accessToken, RefreshToken: refreshToken}, nil
+}
+
+func revokeRefreshTokenFamily(tx *gorm.DB, familyID string) error {
+	return tx.Model(&data.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func RefreshHandler(w http.ResponseWriter, r *http.Request) {
+	var refreshRequest model.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&refreshRequest); err != nil || refreshRequest.RefreshToken == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		log.Printf("Invalid input: %v", err)
+		return
+	}
+
+	var stored data.RefreshToken
+	if err := db.Where("token_hash = ?", hashToken(refreshRequest.RefreshToken)).First(&stored).Error; err != nil {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		log.Printf("Refresh token not found: %v", err)
+		return
+	}
+
+	// A token that has already been rotated or revoked is being replayed, so
+	// the whole family is considered compromised.
+	if stored.UsedAt != nil || stored.RevokedAt != nil {
+		if err := revokeRefreshTokenFamily(db, stored.FamilyID); err != nil {
+			log.Printf("Failed to revoke refresh token family: %v", err)
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		log.Printf("Refresh token reuse detected for user %d, family %s revoked", stored.UserID, stored.FamilyID)
+		return
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		http.Error(w, "Refresh token expired", http.StatusUnauthorized)
+		log.Printf("Refresh token expired for user %d", stored.UserID)
+		return
+	}
+
+	var tokenResponse model.TokenResponse
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Mark the token as used only if nobody else did it first, so two
+		// concurrent refreshes with the same token cannot both succeed.
+		result := tx.Model(&data.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", stored.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+
+		var user data.UserInfo
+		if err := tx.First(&user, stored.UserID).Error; err != nil {
+			return err
+		}
+
+		var err error
+		tokenResponse, err = issueTokenPair(tx, user, stored.FamilyID)
+		return err
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		if err := revokeRefreshTokenFamily(db, stored.FamilyID); err != nil {
+			log.Printf("Failed to revoke refresh token family: %v", err)
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		log.Printf("Refresh token reuse detected for user %d, family %s revoked", stored.UserID, stored.FamilyID)
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		log.Printf("User %d for refresh token not found", stored.UserID)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		log.Printf("Failed to refresh token: %v", err)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(tokenResponse)
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		log.Printf("Failed to marshal response: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
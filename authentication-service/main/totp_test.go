@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// SHA1 test vectors from RFC 6238, appendix B, truncated to six digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, expected := range vectors {
+		code, err := totpCode(secret, unix/totpPeriod)
+		if err != nil {
+			t.Fatalf("Could not compute code: %v", err)
+		}
+		if code != expected {
+			t.Errorf("At %d expected %s; got %s", unix, expected, code)
+		}
+	}
+}
+
+func TestVerifyTOTPRejectsReplay(t *testing.T) {
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Could not generate secret: %v", err)
+	}
+
+	now := time.Now()
+	code, err := totpCode(secret, now.Unix()/totpPeriod)
+	if err != nil {
+		t.Fatalf("Could not compute code: %v", err)
+	}
+
+	step, ok := verifyTOTP(secret, code, now, 0)
+	if !ok {
+		t.Fatalf("Expected current code to be accepted")
+	}
+	if _, ok := verifyTOTP(secret, code, now, step); ok {
+		t.Fatalf("Expected used code to be rejected")
+	}
+	if _, ok := verifyTOTP(secret, code, now.Add(5*time.Minute), 0); ok {
+		t.Fatalf("Expected code outside the skew window to be rejected")
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"assignment1/internal/data"
+	"assignment1/internal/model"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"lms-shared/events"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodeCount         = 10
+	maxLoginChallengeAttempts = 5
+)
+
+var (
+	errChallengeInvalid = errors.New("login challenge is invalid or expired")
+	errSecondFactor     = errors.New("invalid two-factor code")
+)
+
+// normalizeRecoveryCode makes recovery codes comparable regardless of case
+// and the dash they are displayed with.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+func generateRecoveryCodes() ([]string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+	}
+	return codes, nil
+}
+
+// replaceRecoveryCodes invalidates the previous recovery codes of the user and
+// stores hashes of the new ones.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&data.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	for _, code := range codes {
+		stored := data.RecoveryCode{UserID: userID, CodeHash: hashToken(normalizeRecoveryCode(code))}
+		if err := tx.Create(&stored).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// twoFactorEnabled reports whether login of the user needs a second factor.
+func twoFactorEnabled(userID uint) (bool, error) {
+	var count int64
+	err := db.Model(&data.TwoFactor{}).Where("user_id = ? AND enabled", userID).Count(&count).Error
+	return count > 0, err
+}
+
+// createLoginChallenge stores a short-lived challenge that has to be
+// completed with a TOTP or recovery code before tokens are issued.
+func createLoginChallenge(userID uint) (string, error) {
+	challengeToken, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := data.LoginChallenge{
+		UserID:    userID,
+		TokenHash: hashToken(challengeToken),
+		ExpiresAt: time.Now().Add(loginChallengeExpiresIn),
+	}
+	if err := db.Create(&challenge).Error; err != nil {
+		return "", err
+	}
+	return challengeToken, nil
+}
+
+// verifySecondFactor checks a TOTP code, or a recovery code when no TOTP code
+// is given, and consumes it.
+func verifySecondFactor(tx *gorm.DB, userID uint, code, recoveryCode string) error {
+	if code != "" {
+		var twoFactor data.TwoFactor
+		if err := tx.Where("user_id = ? AND enabled", userID).First(&twoFactor).Error; err != nil {
+			return err
+		}
+		step, ok := verifyTOTP(twoFactor.Secret, code, time.Now(), twoFactor.LastUsedStep)
+		if !ok {
+			return errSecondFactor
+		}
+		return tx.Model(&twoFactor).Update("last_used_step", step).Error
+	}
+
+	if recoveryCode != "" {
+		result := tx.Model(&data.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalizeRecoveryCode(recoveryCode))).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errSecondFactor
+		}
+		return nil
+	}
+
+	return errSecondFactor
+}
+
+func EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r)
+
+	enabled, err := twoFactorEnabled(claims.UserId)
+	if err != nil {
+		http.Error(w, "Failed to start two-factor enrollment", http.StatusInternalServerError)
+		log.Printf("Failed to check two-factor state: %v", err)
+		return
+	}
+	if enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		log.Printf("Two-factor authentication already enabled for user %d", claims.UserId)
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		log.Printf("Failed to generate TOTP secret: %v", err)
+		return
+	}
+
+	// A pending secret is replaced when enrollment is started again.
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", claims.UserId).Delete(&data.TwoFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&data.TwoFactor{UserID: claims.UserId, Secret: secret}).Error
+	})
+	if err != nil {
+		http.Error(w, "Failed to start two-factor enrollment", http.StatusInternalServerError)
+		log.Printf("Failed to store TOTP secret: %v", err)
+		return
+	}
+
+	jsonResponse, err := json.Marshal(model.TwoFactorEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(secret, claims.Email),
+	})
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		log.Printf("Failed to marshal response: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+}
+
+func EnableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r)
+
+	var codeRequest model.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&codeRequest); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		log.Printf("Invalid input: %v", err)
+		return
+	}
+
+	var twoFactor data.TwoFactor
+	if err := db.Where("user_id = ?", claims.UserId).First(&twoFactor).Error; err != nil {
+		http.Error(w, "Two-factor enrollment not started", http.StatusNotFound)
+		log.Printf("Two-factor enrollment not found: %v", err)
+		return
+	}
+	if twoFactor.Enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		log.Printf("Two-factor authentication already enabled for user %d", claims.UserId)
+		return
+	}
+
+	step, ok := verifyTOTP(twoFactor.Secret, codeRequest.Code, time.Now(), twoFactor.LastUsedStep)
+	if !ok {
+		http.Error(w, "Invalid two-factor code", http.StatusBadRequest)
+		log.Printf("Invalid TOTP code during enrollment of user %d", claims.UserId)
+		return
+	}
+
+	recoveryCodes, err := generateRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		log.Printf("Failed to generate recovery codes: %v", err)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&twoFactor).Updates(map[string]interface{}{"enabled": true, "last_used_step": step}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, claims.UserId, recoveryCodes)
+	})
+	if err != nil {
+		http.Error(w, "Failed to enable two-factor authentication", http.StatusInternalServerError)
+		log.Printf("Failed to enable two-factor authentication: %v", err)
+		return
+	}
+
+	// Recovery codes are only ever shown in this response.
+	jsonResponse, err := json.Marshal(model.RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		log.Printf("Failed to marshal response: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResponse)
+
+	// Отправка сообщения на почту
+	if err := PublishEvent(claims.Email, claims.Language, events.TwoFactorEnabled{}); err != nil {
+		log.Printf("Failed to send two-factor email to queue: %v", err)
+	}
+}
+
+func DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	claims := claimsFromContext(r)
+
+	var disableRequest model.DisableTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&disableRequest); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		log.Printf("Invalid input: %v", err)
+		return
+	}
+
+	var user data.UserInfo
+	if err := db.First(&user, claims.UserId).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		log.Printf("User not found: %v", err)
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword(user.PasswordHash, []byte(disableRequest.Password)); err != nil {
+		http.Error(w, "Incorrect password", http.StatusForbidden)
+		log.Printf("Incorrect password for user %d", user.ID)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, user.ID, disableRequest.Code, ""); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&data.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&data.TwoFactor{}).Error
+	})
+	if errors.Is(err, errSecondFactor) || errors.Is(err, gorm.ErrRecordNotFound) {
+		http.Error(w, "Invalid two-factor code", http.StatusForbidden)
+		log.Printf("Invalid two-factor code for user %d: %v", user.ID, err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		log.Printf("Failed to disable two-factor authentication: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+
+	// Отправка сообщения на почту
+	if err := PublishEvent(user.Email, user.PreferredLanguage, events.TwoFactorDisabled{}); err != nil {
+		log.Printf("Failed to send two-factor email to queue: %v", err)
+	}
+}
+
+func TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var loginRequest model.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&loginRequest); err != nil || loginRequest.ChallengeToken == "" {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		log.Printf("Invalid input: %v", err)
+		return
+	}
+
+	var challenge data.LoginChallenge
+	if err := db.Where("token_hash = ?", hashToken(loginRequest.ChallengeToken)).First(&challenge).Error; err != nil {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		log.Printf("Login challenge not found: %v", err)
+		return
+	}
+	if challenge.UsedAt != nil || challenge.Attempts >= maxLoginChallengeAttempts || time.Now().After(challenge.ExpiresAt) {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		log.Printf("Login challenge %d is no longer usable", challenge.ID)
+		return
+	}
+
+	var user data.UserInfo
+	if err := db.First(&user, challenge.UserID).Error; err != nil {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		log.Printf("User of login challenge not found: %v", err)
+		return
+	}
+
+	// Second factor failures count towards the same limits as passwords, so
+	// codes cannot be guessed by requesting fresh challenges.
+	ip := clientIP(r)
+	wait, err := loginRetryAfter(accountThrottleKey(user.Email), ipThrottleKey(ip))
+	if err != nil {
+		http.Error(w, "Failed to check login attempts", http.StatusInternalServerError)
+		log.Printf("Failed to check login attempts: %v", err)
+		return
+	}
+	if wait > 0 {
+		writeThrottled(w, wait)
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&data.LoginChallenge{}).
+			Where("id = ? AND used_at IS NULL AND attempts < ?", challenge.ID, maxLoginChallengeAttempts).
+			Update("attempts", gorm.Expr("attempts + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errChallengeInvalid
+		}
+
+		if err := verifySecondFactor(tx, challenge.UserID, loginRequest.Code, loginRequest.RecoveryCode); err != nil {
+			return err
+		}
+
+		return tx.Model(&data.LoginChallenge{}).Where("id = ?", challenge.ID).Update("used_at", time.Now()).Error
+	})
+	if errors.Is(err, errSecondFactor) {
+		// The failed attempt has to be counted even though the transaction
+		// is rolled back.
+		db.Model(&data.LoginChallenge{}).Where("id = ?", challenge.ID).Update("attempts", gorm.Expr("attempts + 1"))
+		recordLoginFailure(user.Email, ip)
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		log.Printf("Invalid two-factor code for user %d", challenge.UserID)
+		return
+	}
+	if errors.Is(err, errChallengeInvalid) {
+		http.Error(w, "Invalid or expired challenge", http.StatusUnauthorized)
+		log.Printf("Login challenge %d is no longer usable: %v", challenge.ID, err)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to verify two-factor code", http.StatusInternalServerError)
+		log.Printf("Failed to verify two-factor code: %v", err)
+		return
+	}
+
+	completeLogin(w, user)
+}
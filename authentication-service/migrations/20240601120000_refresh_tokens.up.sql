@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE refresh_tokens
+(
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    user_id    BIGINT                      NOT NULL REFERENCES user_infos (id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE          NOT NULL,
+    family_id  VARCHAR(36)                 NOT NULL,
+    expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    used_at    TIMESTAMP(0) WITH TIME ZONE,
+    revoked_at TIMESTAMP(0) WITH TIME ZONE
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS refresh_tokens;
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE user_infos
+    ADD COLUMN token_version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE revoked_tokens
+(
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    jti        VARCHAR(36) UNIQUE          NOT NULL,
+    user_id    BIGINT                      NOT NULL,
+    expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX revoked_tokens_expires_at_idx ON revoked_tokens (expires_at);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS revoked_tokens;
+
+ALTER TABLE user_infos
+    DROP COLUMN IF EXISTS token_version;
@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE password_reset_tokens
+(
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    user_id    BIGINT                      NOT NULL REFERENCES user_infos (id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE          NOT NULL,
+    expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    used_at    TIMESTAMP(0) WITH TIME ZONE
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS password_reset_tokens;
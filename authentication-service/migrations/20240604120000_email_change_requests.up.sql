@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE email_change_requests
+(
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    user_id      BIGINT                      NOT NULL REFERENCES user_infos (id) ON DELETE CASCADE,
+    new_email    citext                      NOT NULL,
+    token_hash   VARCHAR(64) UNIQUE          NOT NULL,
+    expires_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    confirmed_at TIMESTAMP(0) WITH TIME ZONE
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS email_change_requests;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE signing_keys
+(
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    kid         VARCHAR(36) UNIQUE          NOT NULL,
+    private_key bytea                       NOT NULL,
+    retired_at  TIMESTAMP(0) WITH TIME ZONE
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS signing_keys;
@@ -0,0 +1,39 @@
+-- +goose Up
+CREATE TABLE two_factors
+(
+    id             BIGSERIAL PRIMARY KEY,
+    created_at     TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    user_id        BIGINT UNIQUE               NOT NULL REFERENCES user_infos (id) ON DELETE CASCADE,
+    secret         VARCHAR(64)                 NOT NULL,
+    enabled        bool                        NOT NULL DEFAULT FALSE,
+    last_used_step BIGINT                      NOT NULL DEFAULT 0
+);
+
+CREATE TABLE recovery_codes
+(
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    user_id    BIGINT                      NOT NULL REFERENCES user_infos (id) ON DELETE CASCADE,
+    code_hash  VARCHAR(64)                 NOT NULL,
+    used_at    TIMESTAMP(0) WITH TIME ZONE
+);
+
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
+
+CREATE TABLE login_challenges
+(
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    user_id    BIGINT                      NOT NULL REFERENCES user_infos (id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE          NOT NULL,
+    attempts   INTEGER                     NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    used_at    TIMESTAMP(0) WITH TIME ZONE
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS login_challenges;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS two_factors;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE login_throttles
+(
+    id              BIGSERIAL PRIMARY KEY,
+    key             VARCHAR(320) UNIQUE         NOT NULL,
+    failures        INTEGER                     NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    blocked_until   TIMESTAMP(0) WITH TIME ZONE
+);
+
+
+-- +goose Down
+DROP TABLE IF EXISTS login_throttles;
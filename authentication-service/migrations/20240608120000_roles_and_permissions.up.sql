@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE roles
+(
+    id   BIGSERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL
+);
+
+CREATE TABLE permissions
+(
+    id   BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL
+);
+
+CREATE TABLE role_permissions
+(
+    role_id       BIGINT NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id BIGINT NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+-- USER was the only non-admin role so far
+UPDATE user_infos SET user_role = 'STUDENT' WHERE user_role = 'USER' OR user_role IS NULL;
+
+
+-- +goose Down
+UPDATE user_infos SET user_role = 'USER' WHERE user_role = 'STUDENT';
+
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,8 @@
+-- +goose Up
+ALTER TABLE user_infos
+    ADD COLUMN preferred_language VARCHAR(16) NOT NULL DEFAULT '';
+
+
+-- +goose Down
+ALTER TABLE user_infos
+    DROP COLUMN IF EXISTS preferred_language;
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"lms-crud-api/internal/data"
+	"lms-crud-api/internal/helpers"
+	"lms-crud-api/middleware"
+)
+
+// manageAnyCoursePermission lets administrators change courses they neither
+// own nor collaborate on.
+const manageAnyCoursePermission = "course:manage"
+
+// publishCoursePermission lets reviewers publish, unpublish and archive
+// courses, and see courses that are not published yet.
+const publishCoursePermission = "course:publish"
+
+// isCourseOwner reports whether the caller owns the course. Only owners may
+// delete a course or change its collaborators.
+func isCourseOwner(claims *middleware.Claims, course *data.Course) bool {
+	return claims.HasPermission(manageAnyCoursePermission) || (course.OwnerID != 0 && course.OwnerID == claims.UserId)
+}
+
+// canEditCourse reports whether the caller may change the course, its modules
+// and its lessons.
+func canEditCourse(models data.Models, claims *middleware.Claims, course *data.Course) (bool, error) {
+	if isCourseOwner(claims, course) {
+		return true, nil
+	}
+	return models.Collaborators.Exists(course.ID, claims.UserId)
+}
+
+// authorizeCourseEdit loads the course and checks that the caller may edit
+// it. When it returns false the response has already been written.
+func authorizeCourseEdit(c *gin.Context, models data.Models, courseID uint) (*data.Course, bool) {
+	course, err := models.Courses.Get(courseID)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return nil, false
+	}
+
+	allowed, err := canEditCourse(models, middleware.ClaimsFromContext(c), course)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return nil, false
+	}
+	if !allowed {
+		helpers.ForbiddenResponse(c, "Only the course owner and its collaborators can edit this course")
+		return nil, false
+	}
+	return course, true
+}
+
+// authorizeModuleEdit loads the module and checks edit rights on its course.
+func authorizeModuleEdit(c *gin.Context, models data.Models, moduleID uint) (*data.Module, bool) {
+	module, err := models.Modules.Get(moduleID)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return nil, false
+	}
+
+	if _, ok := authorizeCourseEdit(c, models, module.CourseID); !ok {
+		return nil, false
+	}
+	return module, true
+}
+
+// authorizeLessonEdit loads the lesson and checks edit rights on the course
+// of its module.
+func authorizeLessonEdit(c *gin.Context, models data.Models, lessonID uint) (*data.Lesson, bool) {
+	lesson, err := models.Lessons.Get(lessonID)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return nil, false
+	}
+
+	if _, ok := authorizeModuleEdit(c, models, lesson.ModuleID); !ok {
+		return nil, false
+	}
+	return lesson, true
+}
+
+// courseViewer describes the caller for listing courses.
+func courseViewer(claims *middleware.Claims) data.CourseViewer {
+	return data.CourseViewer{
+		UserID:    claims.UserId,
+		Publisher: claims.HasPermission(publishCoursePermission) || claims.HasPermission(manageAnyCoursePermission),
+	}
+}
+
+// canViewCourse reports whether the caller may see the course. Drafts are
+// only visible to their authors and to publishers, archived courses stay
+// visible to the students enrolled in them.
+func canViewCourse(models data.Models, claims *middleware.Claims, course *data.Course) (bool, error) {
+	if course.Status == data.CoursePublished || courseViewer(claims).Publisher {
+		return true, nil
+	}
+	canEdit, err := canEditCourse(models, claims, course)
+	if err != nil || canEdit {
+		return canEdit, err
+	}
+	if course.Status == data.CourseArchived {
+		return models.Enrollments.IsEnrolled(course.ID, claims.UserId)
+	}
+	return false, nil
+}
+
+// authorizeCourseView loads the course and checks that the caller may see
+// it. Hidden courses are reported as not found.
+func authorizeCourseView(c *gin.Context, models data.Models, courseID uint) (*data.Course, bool) {
+	course, err := models.Courses.Get(courseID)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return nil, false
+	}
+
+	allowed, err := canViewCourse(models, middleware.ClaimsFromContext(c), course)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return nil, false
+	}
+	if !allowed {
+		helpers.NotFoundResponse(c)
+		return nil, false
+	}
+	return course, true
+}
+
+// authorizeModuleView checks that the caller may see the course of the
+// module.
+func authorizeModuleView(c *gin.Context, models data.Models, moduleID uint) (*data.Module, bool) {
+	module, err := models.Modules.Get(moduleID)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return nil, false
+	}
+
+	if _, ok := authorizeCourseView(c, models, module.CourseID); !ok {
+		return nil, false
+	}
+	return module, true
+}
+
+// contentAccess tells which modules and lessons of a course the caller may
+// open. Editors open everything, enrolled students what they have unlocked
+// and everybody else only sees the outline.
+type contentAccess struct {
+	canEdit       bool
+	enrolled      bool
+	lockedModules map[uint]string
+	lockedLessons map[uint]string
+}
+
+func loadContentAccess(models data.Models, claims *middleware.Claims, courseID uint) (*contentAccess, error) {
+	course, err := models.Courses.Get(courseID)
+	if err != nil {
+		return nil, err
+	}
+	access := &contentAccess{lockedModules: make(map[uint]string), lockedLessons: make(map[uint]string)}
+	access.canEdit, err = canEditCourse(models, claims, course)
+	if err != nil || access.canEdit {
+		return access, err
+	}
+	access.enrolled, err = models.Enrollments.IsEnrolled(courseID, claims.UserId)
+	if err != nil || !access.enrolled {
+		return access, err
+	}
+
+	content, err := models.Courses.GetWithModulesAndLessons(courseID, claims.UserId)
+	if err != nil {
+		return nil, err
+	}
+	for _, module := range content.Modules {
+		if module.Locked {
+			access.lockedModules[module.ID] = module.LockReason
+		}
+		for _, lesson := range module.Lessons {
+			if lesson.Locked {
+				access.lockedLessons[lesson.ID] = lesson.LockReason
+			}
+		}
+	}
+	return access, nil
+}
+
+func (a *contentAccess) canOpenLesson(id uint) bool {
+	_, locked := a.lockedLessons[id]
+	return a.canEdit || (a.enrolled && !locked)
+}
+
+// hideUnreadableLessons clears the content of the lessons of the course the
+// caller may not open.
+func hideUnreadableLessons(models data.Models, claims *middleware.Claims, courseID uint, lessons []*data.Lesson) error {
+	access, err := loadContentAccess(models, claims, courseID)
+	if err != nil {
+		return err
+	}
+	for _, lesson := range lessons {
+		if access.canOpenLesson(lesson.ID) {
+			continue
+		}
+		lesson.LockReason, lesson.Locked = access.lockedLessons[lesson.ID]
+		lesson.HideContent()
+	}
+	return nil
+}
+
+// lessonPointers returns pointers to the lessons so that they can be changed
+// in place.
+func lessonPointers(lessons []data.Lesson) []*data.Lesson {
+	pointers := make([]*data.Lesson, len(lessons))
+	for i := range lessons {
+		pointers[i] = &lessons[i]
+	}
+	return pointers
+}
+
+// moduleLessons returns pointers to the lessons of all the modules.
+func moduleLessons(modules []data.Module) []*data.Lesson {
+	var lessons []*data.Lesson
+	for _, module := range modules {
+		lessons = append(lessons, lessonPointers(module.Lessons)...)
+	}
+	return lessons
+}
@@ -0,0 +1,678 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"io"
+	"lms-crud-api/internal/data"
+	"lms-crud-api/internal/helpers"
+	"lms-crud-api/internal/storage"
+	"lms-crud-api/middleware"
+	"lms-shared/events"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type AssignmentsHandler struct {
+	Models  data.Models
+	Storage storage.Storage
+}
+
+type assignmentInput struct {
+	Title             string     `json:"title"`
+	Description       string     `json:"description"`
+	DueAt             *time.Time `json:"due_at"`
+	MaxPoints         *float64   `json:"max_points"`
+	AllowLate         bool       `json:"allow_late"`
+	AllowResubmission *bool      `json:"allow_resubmission"`
+	AllowText         *bool      `json:"allow_text"`
+	AllowFiles        *bool      `json:"allow_files"`
+	MaxFiles          *int       `json:"max_files"`
+	MaxFileSizeBytes  *int64     `json:"max_file_size_bytes"`
+	AllowedExtensions []string   `json:"allowed_extensions"`
+	CategoryID        *uint      `json:"category_id"`
+	Rubric            []struct {
+		Title     string  `json:"title"`
+		MaxPoints float64 `json:"max_points"`
+	} `json:"rubric"`
+}
+
+// apply copies the input onto the assignment. Settings missing from the input
+// keep their current value, which are the defaults for a new assignment.
+func (input assignmentInput) apply(assignment *data.Assignment) ([]data.RubricCriterion, error) {
+	if input.Title == "" {
+		return nil, errors.New("title must not be empty")
+	}
+
+	assignment.Title = input.Title
+	assignment.Description = input.Description
+	assignment.DueAt = input.DueAt
+	assignment.AllowLate = input.AllowLate
+	assignment.AllowedExtensions = input.AllowedExtensions
+	assignment.CategoryID = input.CategoryID
+	if input.MaxPoints != nil {
+		assignment.MaxPoints = *input.MaxPoints
+	}
+	if input.AllowResubmission != nil {
+		assignment.AllowResubmission = *input.AllowResubmission
+	}
+	if input.AllowText != nil {
+		assignment.AllowText = *input.AllowText
+	}
+	if input.AllowFiles != nil {
+		assignment.AllowFiles = *input.AllowFiles
+	}
+	if input.MaxFiles != nil {
+		assignment.MaxFiles = *input.MaxFiles
+	}
+	if input.MaxFileSizeBytes != nil {
+		assignment.MaxFileSizeBytes = *input.MaxFileSizeBytes
+	}
+
+	if assignment.MaxPoints <= 0 {
+		return nil, errors.New("max_points must be positive")
+	}
+	if !assignment.AllowText && !assignment.AllowFiles {
+		return nil, errors.New("an assignment has to accept text or files")
+	}
+	if assignment.AllowFiles && (assignment.MaxFiles < 1 || assignment.MaxFileSizeBytes < 1) {
+		return nil, errors.New("max_files and max_file_size_bytes must be positive when files are allowed")
+	}
+
+	if input.Rubric == nil {
+		return nil, nil
+	}
+	rubric := make([]data.RubricCriterion, 0, len(input.Rubric))
+	var total float64
+	for i, criterion := range input.Rubric {
+		if criterion.Title == "" || criterion.MaxPoints <= 0 {
+			return nil, fmt.Errorf("rubric criterion %d needs a title and positive max_points", i+1)
+		}
+		total += criterion.MaxPoints
+		rubric = append(rubric, data.RubricCriterion{Position: i, Title: criterion.Title, MaxPoints: criterion.MaxPoints})
+	}
+	if len(rubric) > 0 && math.Abs(total-assignment.MaxPoints) > 1e-9 {
+		return nil, errors.New("the rubric points must add up to max_points")
+	}
+	return rubric, nil
+}
+
+func newAssignment(moduleID uint) *data.Assignment {
+	return &data.Assignment{
+		ModuleID:          moduleID,
+		MaxPoints:         100,
+		AllowResubmission: true,
+		AllowText:         true,
+		AllowFiles:        true,
+		MaxFiles:          5,
+		MaxFileSizeBytes:  10 << 20,
+	}
+}
+
+func (h *AssignmentsHandler) CreateAssignmentHandler(c *gin.Context) {
+	var input struct {
+		assignmentInput
+		ModuleID uint `json:"module_id"`
+	}
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	assignment := newAssignment(input.ModuleID)
+	rubric, err := input.apply(assignment)
+	if err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+	assignment.Rubric = rubric
+
+	module, ok := authorizeModuleEdit(c, h.Models, input.ModuleID)
+	if !ok {
+		return
+	}
+	if !checkCategory(c, h.Models, assignment.CategoryID, module.CourseID) {
+		return
+	}
+
+	if err := h.Models.Assignments.Insert(assignment); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusCreated, gin.H{"assignment": assignment})
+}
+
+func (h *AssignmentsHandler) ShowAssignmentsForModuleHandler(c *gin.Context) {
+	moduleID, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	if _, ok := authorizeModuleView(c, h.Models, moduleID); !ok {
+		return
+	}
+
+	assignments, err := h.Models.Assignments.GetAllForModule(moduleID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"assignments": assignments})
+}
+
+func (h *AssignmentsHandler) ShowAssignmentHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	assignment, err := h.Models.Assignments.Get(id)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+	if _, ok := authorizeModuleView(c, h.Models, assignment.ModuleID); !ok {
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"assignment": assignment})
+}
+
+func (h *AssignmentsHandler) UpdateAssignmentHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	var input assignmentInput
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	assignment, ok := h.authorizeAssignmentEdit(c, id)
+	if !ok {
+		return
+	}
+
+	rubric, err := input.apply(assignment)
+	if err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	module, err := h.Models.Modules.Get(assignment.ModuleID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	if !checkCategory(c, h.Models, assignment.CategoryID, module.CourseID) {
+		return
+	}
+
+	err = h.Models.Assignments.Update(assignment, rubric)
+	if err == data.ErrSubmissionGraded {
+		helpers.ConflictResponse(c, errors.New("the rubric cannot change after submissions were graded"))
+		return
+	}
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"assignment": assignment})
+}
+
+func (h *AssignmentsHandler) DeleteAssignmentHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	if _, ok := h.authorizeAssignmentEdit(c, id); !ok {
+		return
+	}
+
+	if err := h.Models.Assignments.Delete(id); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AssignmentsHandler) authorizeAssignmentEdit(c *gin.Context, id uint) (*data.Assignment, bool) {
+	assignment, err := h.Models.Assignments.Get(id)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return nil, false
+	}
+
+	if _, ok := authorizeModuleEdit(c, h.Models, assignment.ModuleID); !ok {
+		return nil, false
+	}
+	return assignment, true
+}
+
+// canEditAssignment reports whether the caller may see all submissions of
+// the assignment and grade them.
+func (h *AssignmentsHandler) canEditAssignment(c *gin.Context, assignment *data.Assignment) (bool, error) {
+	module, err := h.Models.Modules.Get(assignment.ModuleID)
+	if err != nil {
+		return false, err
+	}
+	course, err := h.Models.Courses.Get(module.CourseID)
+	if err != nil {
+		return false, err
+	}
+	return canEditCourse(h.Models, middleware.ClaimsFromContext(c), course)
+}
+
+func (h *AssignmentsHandler) isEnrolled(c *gin.Context, assignment *data.Assignment) (bool, error) {
+	module, err := h.Models.Modules.Get(assignment.ModuleID)
+	if err != nil {
+		return false, err
+	}
+	return h.Models.Enrollments.IsEnrolled(module.CourseID, middleware.ClaimsFromContext(c).UserId)
+}
+
+func newStorageKey(assignmentID, userID uint, fileName string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("submissions/%d/%d/%s%s", assignmentID, userID, hex.EncodeToString(b), filepath.Ext(fileName)), nil
+}
+
+// submissionFormOverhead leaves room for the text field and the multipart
+// headers on top of the files of a submission.
+const submissionFormOverhead = 1 << 20
+
+var errFileTooLarge = errors.New("the file is larger than the assignment allows")
+
+// maxSubmissionBytes is the largest request body accepted for a submission
+// to the assignment.
+func maxSubmissionBytes(assignment *data.Assignment) int64 {
+	limit := int64(submissionFormOverhead)
+	if assignment.AllowFiles {
+		limit += int64(assignment.MaxFiles) * assignment.MaxFileSizeBytes
+	}
+	return limit
+}
+
+// sizeLimitedReader fails with errFileTooLarge once more than n bytes have
+// been read, where io.LimitReader would silently cut the file short.
+type sizeLimitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errFileTooLarge
+	}
+	return n, err
+}
+
+// checkFiles applies the submission rules of the assignment to the uploads.
+func checkFiles(assignment *data.Assignment, files []*multipart.FileHeader) error {
+	if len(files) == 0 {
+		return nil
+	}
+	if !assignment.AllowFiles {
+		return errors.New("this assignment does not accept files")
+	}
+	if len(files) > assignment.MaxFiles {
+		return fmt.Errorf("at most %d files can be submitted", assignment.MaxFiles)
+	}
+	for _, file := range files {
+		if file.Size > assignment.MaxFileSizeBytes {
+			return fmt.Errorf("%s is larger than %d bytes", file.Filename, assignment.MaxFileSizeBytes)
+		}
+		if !assignment.AcceptsExtension(file.Filename) {
+			return fmt.Errorf("%s has a file type that is not accepted", file.Filename)
+		}
+	}
+	return nil
+}
+
+func (h *AssignmentsHandler) storeFile(assignment *data.Assignment, userID uint, header *multipart.FileHeader) (data.SubmissionFile, error) {
+	key, err := newStorageKey(assignment.ID, userID, header.Filename)
+	if err != nil {
+		return data.SubmissionFile{}, err
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return data.SubmissionFile{}, err
+	}
+	defer file.Close()
+
+	size, err := h.Storage.Save(key, &sizeLimitedReader{r: file, n: assignment.MaxFileSizeBytes})
+	if err != nil {
+		return data.SubmissionFile{}, err
+	}
+
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return data.SubmissionFile{
+		FileName:    filepath.Base(header.Filename),
+		ContentType: contentType,
+		Size:        size,
+		StorageKey:  key,
+	}, nil
+}
+
+func (h *AssignmentsHandler) removeFiles(files []data.SubmissionFile) {
+	for _, file := range files {
+		if err := h.Storage.Delete(file.StorageKey); err != nil {
+			logger.Error().Err(err).Msgf("Failed to delete file %s", file.StorageKey)
+		}
+	}
+}
+
+// SubmitHandler accepts a multipart form with an optional "text" field and
+// any number of "files". Submitting again replaces the previous hand-in as
+// long as it was not graded.
+func (h *AssignmentsHandler) SubmitHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	assignment, err := h.Models.Assignments.Get(id)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	enrolled, err := h.isEnrolled(c, assignment)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	if !enrolled {
+		helpers.ForbiddenResponse(c, "Only students enrolled in the course can submit this assignment")
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSubmissionBytes(assignment))
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			helpers.RequestTooLargeResponse(c, fmt.Errorf("the submission is larger than %d bytes", tooLarge.Limit))
+			return
+		}
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+	text := c.PostForm("text")
+	files := form.File["files"]
+
+	if text != "" && !assignment.AllowText {
+		helpers.BadRequestResponse(c, errors.New("this assignment does not accept text"))
+		return
+	}
+	if err := checkFiles(assignment, files); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+	if text == "" && len(files) == 0 {
+		helpers.BadRequestResponse(c, errors.New("the submission is empty"))
+		return
+	}
+
+	now := time.Now()
+	late := assignment.IsLate(now)
+	if late && !assignment.AllowLate {
+		helpers.ConflictResponse(c, data.ErrSubmissionClosed)
+		return
+	}
+
+	claims := middleware.ClaimsFromContext(c)
+	submission := &data.Submission{
+		AssignmentID: assignment.ID,
+		UserID:       claims.UserId,
+		Email:        claims.Email,
+		Language:     claims.Language,
+		Text:         text,
+		SubmittedAt:  now,
+		Late:         late,
+	}
+	for _, header := range files {
+		file, err := h.storeFile(assignment, claims.UserId, header)
+		if err != nil {
+			h.removeFiles(submission.Files)
+			if errors.Is(err, errFileTooLarge) {
+				helpers.RequestTooLargeResponse(c, fmt.Errorf("%s is larger than %d bytes", header.Filename, assignment.MaxFileSizeBytes))
+				return
+			}
+			helpers.ServerErrorResponse(c, err)
+			return
+		}
+		submission.Files = append(submission.Files, file)
+	}
+
+	replaced, err := h.Models.Assignments.SaveSubmission(assignment, submission)
+	if err != nil {
+		h.removeFiles(submission.Files)
+		if err == data.ErrSubmissionGraded || err == data.ErrResubmissionDenied {
+			helpers.ConflictResponse(c, err)
+			return
+		}
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	h.removeFiles(replaced)
+
+	helpers.WriteJSON(c, http.StatusCreated, gin.H{"submission": submission})
+}
+
+func (h *AssignmentsHandler) ShowMySubmissionHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	submission, err := h.Models.Assignments.GetSubmissionForUser(id, middleware.ClaimsFromContext(c).UserId)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"submission": submission})
+}
+
+func (h *AssignmentsHandler) ShowSubmissionsHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	if _, ok := h.authorizeAssignmentEdit(c, id); !ok {
+		return
+	}
+
+	submissions, err := h.Models.Assignments.GetSubmissionsForAssignment(id)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"submissions": submissions})
+}
+
+// DownloadSubmissionFileHandler streams a submitted file to its author or to
+// the editors of the course.
+func (h *AssignmentsHandler) DownloadSubmissionFileHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+	fileID, err := strconv.ParseUint(c.Param("fileId"), 10, 32)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	submission, err := h.Models.Assignments.GetSubmission(id)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	if submission.UserID != middleware.ClaimsFromContext(c).UserId {
+		assignment, err := h.Models.Assignments.Get(submission.AssignmentID)
+		if err != nil {
+			helpers.NotFoundResponse(c)
+			return
+		}
+		canEdit, err := h.canEditAssignment(c, assignment)
+		if err != nil {
+			helpers.ServerErrorResponse(c, err)
+			return
+		}
+		if !canEdit {
+			helpers.NotFoundResponse(c)
+			return
+		}
+	}
+
+	for _, file := range submission.Files {
+		if file.ID != uint(fileID) {
+			continue
+		}
+
+		r, err := h.Storage.Open(file.StorageKey)
+		if err != nil {
+			helpers.ServerErrorResponse(c, err)
+			return
+		}
+		defer r.Close()
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.FileName))
+		c.DataFromReader(http.StatusOK, file.Size, file.ContentType, r, nil)
+		return
+	}
+
+	helpers.NotFoundResponse(c)
+}
+
+// GradeSubmissionHandler grades a submission. With a rubric the grade is the
+// sum of the criterion scores, otherwise it is taken from "points".
+func (h *AssignmentsHandler) GradeSubmissionHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	var input struct {
+		Points   *float64 `json:"points"`
+		Feedback string   `json:"feedback"`
+		Rubric   []struct {
+			CriterionID uint    `json:"criterion_id"`
+			Points      float64 `json:"points"`
+			Comment     string  `json:"comment"`
+		} `json:"rubric"`
+	}
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	submission, err := h.Models.Assignments.GetSubmission(id)
+	if err == gorm.ErrRecordNotFound {
+		helpers.NotFoundResponse(c)
+		return
+	}
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	assignment, ok := h.authorizeAssignmentEdit(c, submission.AssignmentID)
+	if !ok {
+		return
+	}
+
+	var grade float64
+	var scores []data.RubricScore
+	if len(assignment.Rubric) > 0 {
+		criteria := make(map[uint]data.RubricCriterion, len(assignment.Rubric))
+		for _, criterion := range assignment.Rubric {
+			criteria[criterion.ID] = criterion
+		}
+		scored := make(map[uint]bool, len(input.Rubric))
+		for _, score := range input.Rubric {
+			criterion, ok := criteria[score.CriterionID]
+			if !ok || scored[score.CriterionID] {
+				helpers.BadRequestResponse(c, errors.New("every rubric criterion has to be scored exactly once"))
+				return
+			}
+			scored[score.CriterionID] = true
+			if score.Points < 0 || score.Points > criterion.MaxPoints {
+				helpers.BadRequestResponse(c, fmt.Errorf("points for %s must be between 0 and %g", criterion.Title, criterion.MaxPoints))
+				return
+			}
+			grade += score.Points
+			scores = append(scores, data.RubricScore{CriterionID: score.CriterionID, Points: score.Points, Comment: score.Comment})
+		}
+		if len(scored) != len(criteria) {
+			helpers.BadRequestResponse(c, errors.New("every rubric criterion has to be scored exactly once"))
+			return
+		}
+	} else {
+		if input.Points == nil {
+			helpers.BadRequestResponse(c, errors.New("points are required"))
+			return
+		}
+		grade = *input.Points
+		if grade < 0 || grade > assignment.MaxPoints {
+			helpers.BadRequestResponse(c, fmt.Errorf("points must be between 0 and %g", assignment.MaxPoints))
+			return
+		}
+	}
+
+	now := time.Now()
+	graderID := middleware.ClaimsFromContext(c).UserId
+	submission.Grade = &grade
+	submission.Feedback = input.Feedback
+	submission.GradedAt = &now
+	submission.GradedBy = &graderID
+
+	if err := h.Models.Assignments.GradeSubmission(submission, scores); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	h.Models.Courses.PublishEventToUser(logger, ch, submission.Email, submission.Language, events.SubmissionGraded{AssignmentID: assignment.ID, AssignmentTitle: assignment.Title, Grade: grade, MaxPoints: assignment.MaxPoints})
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"submission": submission})
+}
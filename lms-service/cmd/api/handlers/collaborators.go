@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"lms-crud-api/internal/data"
+	"lms-crud-api/internal/helpers"
+	"lms-crud-api/middleware"
+	"net/http"
+	"strconv"
+)
+
+// authorizeCourseOwner loads the course and checks that the caller owns it.
+func (h *CoursesHandler) authorizeCourseOwner(c *gin.Context) (*data.Course, bool) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return nil, false
+	}
+
+	course, err := h.Models.Courses.Get(id)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return nil, false
+	}
+
+	if !isCourseOwner(middleware.ClaimsFromContext(c), course) {
+		helpers.ForbiddenResponse(c, "Only the course owner can manage its collaborators")
+		return nil, false
+	}
+	return course, true
+}
+
+func (h *CoursesHandler) ShowCollaboratorsHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	course, ok := authorizeCourseEdit(c, h.Models, id)
+	if !ok {
+		return
+	}
+
+	collaborators, err := h.Models.Collaborators.GetAllForCourse(course.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"owner_id": course.OwnerID, "collaborators": collaborators})
+}
+
+func (h *CoursesHandler) AddCollaboratorHandler(c *gin.Context) {
+	var input struct {
+		UserID uint `json:"user_id"`
+	}
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	course, ok := h.authorizeCourseOwner(c)
+	if !ok {
+		return
+	}
+
+	if input.UserID == 0 {
+		helpers.BadRequestResponse(c, errors.New("user_id is required"))
+		return
+	}
+	if input.UserID == course.OwnerID {
+		helpers.BadRequestResponse(c, errors.New("the owner is already allowed to edit the course"))
+		return
+	}
+
+	exists, err := h.Models.Collaborators.Exists(course.ID, input.UserID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	if exists {
+		helpers.BadRequestResponse(c, errors.New("the user is already a collaborator"))
+		return
+	}
+
+	collaborator := &data.CourseCollaborator{
+		CourseID: course.ID,
+		UserID:   input.UserID,
+	}
+
+	if err := h.Models.Collaborators.Insert(collaborator); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusCreated, gin.H{"collaborator": collaborator})
+}
+
+func (h *CoursesHandler) RemoveCollaboratorHandler(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	course, ok := h.authorizeCourseOwner(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Models.Collaborators.Delete(course.ID, uint(userID)); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
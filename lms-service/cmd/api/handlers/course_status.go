@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"lms-crud-api/internal/data"
+	"lms-crud-api/internal/helpers"
+	"lms-crud-api/middleware"
+	"lms-shared/events"
+	"net/http"
+	"time"
+)
+
+// UpdateCourseStatusHandler moves a course through the publishing workflow.
+// Publishing with a publish_at in the future schedules the course instead.
+func (h *CoursesHandler) UpdateCourseStatusHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	var input struct {
+		Status    string     `json:"status"`
+		PublishAt *time.Time `json:"publish_at"`
+	}
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+	if input.PublishAt != nil && input.Status != data.CoursePublished {
+		helpers.BadRequestResponse(c, errors.New("publish_at can only be set when publishing"))
+		return
+	}
+
+	course, ok := authorizeCourseEdit(c, h.Models, id)
+	if !ok {
+		return
+	}
+
+	publisherOnly, err := data.CourseTransition(course.Status, input.Status)
+	if err != nil {
+		helpers.BadRequestResponse(c, fmt.Errorf("%w: %s to %s", err, course.Status, input.Status))
+		return
+	}
+	claims := middleware.ClaimsFromContext(c)
+	if publisherOnly && !claims.HasPermission(publishCoursePermission) {
+		helpers.ForbiddenResponse(c, "Only publishers can make this change")
+		return
+	}
+
+	err = h.Models.Courses.SetStatus(course, input.Status, input.PublishAt, claims.Email, claims.Language)
+	switch {
+	case errors.Is(err, data.ErrCourseStatusChange):
+		helpers.ConflictResponse(c, err)
+		return
+	case err != nil:
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	if course.Status == data.CoursePublished {
+		h.Models.Courses.PublishEvent(logger, ch, c, events.CoursePublished{CourseID: course.ID, Title: course.Title})
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"course": course})
+}
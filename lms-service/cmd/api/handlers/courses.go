@@ -1,63 +1,104 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
+	"github.com/streadway/amqp"
 	"lms-crud-api/internal/data"
 	"lms-crud-api/internal/helpers"
 	"lms-crud-api/middleware"
+	"lms-shared/events"
+	"lms-shared/query"
 	"net/http"
 	"os"
+	"time"
 )
 
 var (
 	logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
-	ch, _  = data.ConnectToRabbitMQ()
+	ch     *amqp.Channel
 )
 
+// SetNotificationChannel sets the RabbitMQ channel the handlers publish
+// notifications on. It has to be called before the routes are served.
+func SetNotificationChannel(channel *amqp.Channel) {
+	ch = channel
+}
+
 type CoursesHandler struct {
 	Models data.Models
 }
 
-func (h *CoursesHandler) CreateCourseHandler(c *gin.Context) {
-	var input struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
+// courseInput is the body accepted when creating or updating a course.
+type courseInput struct {
+	Title              string     `json:"title"`
+	Description        string     `json:"description"`
+	Capacity           *int       `json:"capacity"`
+	EnrollmentOpensAt  *time.Time `json:"enrollment_opens_at"`
+	EnrollmentClosesAt *time.Time `json:"enrollment_closes_at"`
+	Sequential         bool       `json:"sequential"`
+}
+
+func (input courseInput) validate() error {
+	if input.Capacity != nil && *input.Capacity < 1 {
+		return errors.New("capacity must be at least 1")
+	}
+	if input.EnrollmentOpensAt != nil && input.EnrollmentClosesAt != nil && !input.EnrollmentClosesAt.After(*input.EnrollmentOpensAt) {
+		return errors.New("enrollment_closes_at must be after enrollment_opens_at")
 	}
+	return nil
+}
+
+func (h *CoursesHandler) CreateCourseHandler(c *gin.Context) {
+	var input courseInput
 
 	if err := c.BindJSON(&input); err != nil {
 		helpers.BadRequestResponse(c, err)
 		return
 	}
 
+	if err := input.validate(); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
 	course := &data.Course{
-		Title:       input.Title,
-		Description: input.Description,
+		Title:              input.Title,
+		Description:        input.Description,
+		OwnerID:            middleware.ClaimsFromContext(c).UserId,
+		Status:             data.CourseDraft,
+		Capacity:           input.Capacity,
+		EnrollmentOpensAt:  input.EnrollmentOpensAt,
+		EnrollmentClosesAt: input.EnrollmentClosesAt,
+		Sequential:         input.Sequential,
 	}
 
-	if err := h.Models.Courses.Insert(course); err != nil {
+	if err := h.Models.Courses.Insert(course, revisionMeta(c)); err != nil {
 		helpers.ServerErrorResponse(c, err)
 		return
 	}
 
-	h.Models.Courses.SendMessageToQueue(logger, ch, c, fmt.Sprintf("New course: %s is added!", course.Title))
+	h.Models.Courses.PublishEvent(logger, ch, c, events.CourseCreated{CourseID: course.ID, Title: course.Title})
 
 	helpers.WriteJSON(c, http.StatusCreated, gin.H{"course": course})
 }
 
 func (h *CoursesHandler) ShowAllCoursesHandler(c *gin.Context) {
-	courses, err := h.Models.Courses.GetAllWithModulesAndLessons() // Update GetAllWithModulesAndLessons to preload modules and lessons
+	q, err := query.Parse(c.Request.URL.Query(), data.CourseListSpec)
+	if err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	viewer := courseViewer(middleware.ClaimsFromContext(c))
+	courses, metadata, err := h.Models.Courses.GetAllWithModulesAndLessons(viewer, q)
 	if err != nil {
 		helpers.ServerErrorResponse(c, err)
 		return
 	}
 
-	println(c.GetHeader("Authorization"))
-	claims, _ := c.Get("claims")
-	userClaims := claims.(*middleware.Claims)
-	print(userClaims.UserId)
-	helpers.WriteJSON(c, http.StatusOK, gin.H{"courses": courses})
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"courses": courses, "metadata": metadata})
 }
 
 func (h *CoursesHandler) ShowCourseHandler(c *gin.Context) {
@@ -67,11 +108,30 @@ func (h *CoursesHandler) ShowCourseHandler(c *gin.Context) {
 		return
 	}
 
-	course, err := h.Models.Courses.GetWithModulesAndLessons(id) // Update GetWithModulesAndLessons to preload modules and lessons
+	if _, ok := authorizeCourseView(c, h.Models, id); !ok {
+		return
+	}
+
+	// Progress is only tracked for students enrolled in the course.
+	userID := middleware.ClaimsFromContext(c).UserId
+	enrolled, err := h.Models.Enrollments.IsEnrolled(id, userID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	if !enrolled {
+		userID = 0
+	}
+
+	course, err := h.Models.Courses.GetWithModulesAndLessons(id, userID)
 	if err != nil {
 		helpers.NotFoundResponse(c)
 		return
 	}
+	if err := hideUnreadableLessons(h.Models, middleware.ClaimsFromContext(c), id, moduleLessons(course.Modules)); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
 
 	helpers.WriteJSON(c, http.StatusOK, gin.H{"course": course})
 }
@@ -83,10 +143,7 @@ func (h *CoursesHandler) UpdateCourseHandler(c *gin.Context) {
 		return
 	}
 
-	var input struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
-	}
+	var input courseInput
 
 	err = c.BindJSON(&input)
 	if err != nil {
@@ -94,22 +151,34 @@ func (h *CoursesHandler) UpdateCourseHandler(c *gin.Context) {
 		return
 	}
 
-	course, err := h.Models.Courses.Get(id)
-	if err != nil {
-		helpers.NotFoundResponse(c)
+	if err := input.validate(); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	course, ok := authorizeCourseEdit(c, h.Models, id)
+	if !ok {
 		return
 	}
 
 	course.Title = input.Title
 	course.Description = input.Description
-
-	err = h.Models.Courses.Update(course)
-	if err != nil {
+	course.Capacity = input.Capacity
+	course.EnrollmentOpensAt = input.EnrollmentOpensAt
+	course.EnrollmentClosesAt = input.EnrollmentClosesAt
+	course.Sequential = input.Sequential
+
+	err = h.Models.Courses.Update(course, revisionMeta(c))
+	switch {
+	case errors.Is(err, data.ErrPrerequisiteCycle):
+		helpers.BadRequestResponse(c, err)
+		return
+	case err != nil:
 		helpers.ServerErrorResponse(c, err)
 		return
 	}
 
-	h.Models.Courses.SendMessageToQueue(logger, ch, c, fmt.Sprintf("The %s course is updated!", course.Title))
+	h.Models.Courses.PublishEvent(logger, ch, c, events.CourseUpdated{CourseID: course.ID, Title: course.Title})
 
 	helpers.WriteJSON(c, http.StatusOK, gin.H{"course": course})
 }
@@ -121,6 +190,17 @@ func (h *CoursesHandler) DeleteCourseHandler(c *gin.Context) {
 		return
 	}
 
+	course, err := h.Models.Courses.Get(id)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	if !isCourseOwner(middleware.ClaimsFromContext(c), course) {
+		helpers.ForbiddenResponse(c, "Only the course owner can delete this course")
+		return
+	}
+
 	err = h.Models.Courses.Delete(id)
 	if err != nil {
 		helpers.ServerErrorResponse(c, err)
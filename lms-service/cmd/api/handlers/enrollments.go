@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"lms-crud-api/internal/data"
+	"lms-crud-api/internal/helpers"
+	"lms-crud-api/middleware"
+	"lms-shared/events"
+	"net/http"
+)
+
+type EnrollmentsHandler struct {
+	Models data.Models
+}
+
+func (h *EnrollmentsHandler) EnrollHandler(c *gin.Context) {
+	courseID, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	claims := middleware.ClaimsFromContext(c)
+	enrollment, err := h.Models.Enrollments.Enroll(courseID, claims.UserId, claims.Email)
+	switch err {
+	case nil:
+	case gorm.ErrRecordNotFound:
+		helpers.NotFoundResponse(c)
+		return
+	case data.ErrAlreadyEnrolled, data.ErrCourseFull, data.ErrEnrollmentClosed:
+		helpers.ConflictResponse(c, err)
+		return
+	default:
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	courseName := h.Models.Courses.GetCourseNameById(int(courseID))
+	h.Models.Courses.PublishEvent(logger, ch, c, events.EnrollmentCreated{CourseID: courseID, CourseTitle: courseName})
+
+	helpers.WriteJSON(c, http.StatusCreated, gin.H{"enrollment": enrollment})
+}
+
+func (h *EnrollmentsHandler) UnenrollHandler(c *gin.Context) {
+	courseID, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	err = h.Models.Enrollments.Delete(courseID, middleware.ClaimsFromContext(c).UserId)
+	if err == data.ErrNotEnrolled {
+		helpers.NotFoundResponse(c)
+		return
+	}
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	courseName := h.Models.Courses.GetCourseNameById(int(courseID))
+	h.Models.Courses.PublishEvent(logger, ch, c, events.EnrollmentCancelled{CourseID: courseID, CourseTitle: courseName})
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *EnrollmentsHandler) ShowMyCoursesHandler(c *gin.Context) {
+	courses, err := h.Models.Enrollments.GetCoursesForUser(middleware.ClaimsFromContext(c).UserId)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"courses": courses})
+}
+
+// ShowRosterHandler lists the students of a course. It is available to the
+// people who may edit the course.
+func (h *EnrollmentsHandler) ShowRosterHandler(c *gin.Context) {
+	courseID, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	course, ok := authorizeCourseEdit(c, h.Models, courseID)
+	if !ok {
+		return
+	}
+
+	enrollments, err := h.Models.Enrollments.GetAllForCourse(course.ID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"capacity": course.Capacity, "enrollments": enrollments})
+}
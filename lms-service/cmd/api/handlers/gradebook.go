@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"lms-crud-api/internal/data"
+	"lms-crud-api/internal/helpers"
+	"lms-crud-api/middleware"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type GradebookHandler struct {
+	Models data.Models
+}
+
+// checkCategory makes sure a gradebook category picked for a quiz or an
+// assignment belongs to the same course. When it returns false the response
+// has already been written.
+func checkCategory(c *gin.Context, models data.Models, categoryID *uint, courseID uint) bool {
+	if categoryID == nil {
+		return true
+	}
+	ok, err := models.Gradebook.CategoryInCourse(*categoryID, courseID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return false
+	}
+	if !ok {
+		helpers.BadRequestResponse(c, errors.New("category_id does not belong to the course"))
+		return false
+	}
+	return true
+}
+
+func (h *GradebookHandler) ShowGradebookHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	if _, ok := authorizeCourseEdit(c, h.Models, id); !ok {
+		return
+	}
+
+	gradebook, err := h.Models.Gradebook.Get(id, 0)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"gradebook": gradebook})
+}
+
+func (h *GradebookHandler) ShowMyGradesHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	userID := middleware.ClaimsFromContext(c).UserId
+	enrolled, err := h.Models.Enrollments.IsEnrolled(id, userID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	if !enrolled {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	gradebook, err := h.Models.Gradebook.Get(id, userID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	if len(gradebook.Students) == 0 {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{
+		"items":      gradebook.Items,
+		"categories": gradebook.Categories,
+		"grades":     gradebook.Students[0],
+	})
+}
+
+func (h *GradebookHandler) ShowSettingsHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	if _, ok := authorizeCourseEdit(c, h.Models, id); !ok {
+		return
+	}
+
+	settings, err := h.Models.Gradebook.GetSettings(id)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	categories, err := h.Models.Gradebook.GetCategories(id)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"settings": settings, "categories": categories})
+}
+
+func (h *GradebookHandler) UpdateSettingsHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	var input struct {
+		LatePenaltyPerDay float64            `json:"late_penalty_per_day"`
+		MaxLatePenalty    *float64           `json:"max_late_penalty"`
+		LetterScale       []data.LetterGrade `json:"letter_scale"`
+		Categories        []struct {
+			ID         uint    `json:"id"`
+			Name       string  `json:"name"`
+			Weight     float64 `json:"weight"`
+			DropLowest int     `json:"drop_lowest"`
+		} `json:"categories"`
+	}
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	settings := &data.GradebookSettings{
+		CourseID:          id,
+		LatePenaltyPerDay: input.LatePenaltyPerDay,
+		MaxLatePenalty:    100,
+		LetterScale:       input.LetterScale,
+	}
+	if input.MaxLatePenalty != nil {
+		settings.MaxLatePenalty = *input.MaxLatePenalty
+	}
+	if settings.LatePenaltyPerDay < 0 || settings.MaxLatePenalty < 0 || settings.MaxLatePenalty > 100 {
+		helpers.BadRequestResponse(c, errors.New("late penalties must be percentages between 0 and 100"))
+		return
+	}
+	for _, grade := range settings.LetterScale {
+		if grade.Letter == "" || grade.MinPercent < 0 {
+			helpers.BadRequestResponse(c, errors.New("every letter grade needs a letter and a non-negative min_percent"))
+			return
+		}
+	}
+
+	categories := make([]data.GradeCategory, 0, len(input.Categories))
+	for _, category := range input.Categories {
+		if category.Name == "" || category.Weight <= 0 || category.DropLowest < 0 {
+			helpers.BadRequestResponse(c, errors.New("every category needs a name, a positive weight and a non-negative drop_lowest"))
+			return
+		}
+		categories = append(categories, data.GradeCategory{ID: category.ID, Name: category.Name, Weight: category.Weight, DropLowest: category.DropLowest})
+	}
+
+	if _, ok := authorizeCourseEdit(c, h.Models, id); !ok {
+		return
+	}
+
+	if err := h.Models.Gradebook.SaveSettings(settings, categories); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"settings": settings, "categories": categories})
+}
+
+func formatPoints(points *float64) string {
+	if points == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*points, 'f', -1, 64)
+}
+
+// ExportGradebookHandler writes the gradebook as CSV. Item columns are titled
+// "<title> [<key>]" so the file can be edited and imported again.
+func (h *GradebookHandler) ExportGradebookHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	if _, ok := authorizeCourseEdit(c, h.Models, id); !ok {
+		return
+	}
+
+	gradebook, err := h.Models.Gradebook.Get(id, 0)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"gradebook-course-%d.csv\"", id))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	header := []string{"user_id", "email"}
+	for _, item := range gradebook.Items {
+		header = append(header, fmt.Sprintf("%s [%s]", item.Title, item.Key))
+	}
+	header = append(header, "percent", "letter")
+	w.Write(header)
+
+	for _, student := range gradebook.Students {
+		row := []string{strconv.FormatUint(uint64(student.UserID), 10), student.Email}
+		for _, item := range gradebook.Items {
+			row = append(row, formatPoints(student.Entries[item.Key].Points))
+		}
+		row = append(row, formatPoints(student.Percent), student.Letter)
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		logger.Error().Err(err).Msg("Failed to write gradebook CSV")
+	}
+}
+
+// itemKeyFromHeader extracts the item key from an exported column title.
+func itemKeyFromHeader(title string) string {
+	title = strings.TrimSpace(title)
+	if open := strings.LastIndex(title, "["); open != -1 && strings.HasSuffix(title, "]") {
+		return title[open+1 : len(title)-1]
+	}
+	return title
+}
+
+// ImportGradebookHandler reads a CSV in the export format from the request
+// body and stores the scores as overrides. Empty cells and the computed
+// columns are ignored. Nothing is saved when any row is invalid.
+func (h *GradebookHandler) ImportGradebookHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	if _, ok := authorizeCourseEdit(c, h.Models, id); !ok {
+		return
+	}
+
+	gradebook, err := h.Models.Gradebook.Get(id, 0)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	items := make(map[string]data.GradeItem, len(gradebook.Items))
+	for _, item := range gradebook.Items {
+		items[item.Key] = item
+	}
+	students := make(map[uint]*data.StudentGrades, len(gradebook.Students))
+	for _, student := range gradebook.Students {
+		students[student.UserID] = student
+	}
+
+	r := csv.NewReader(c.Request.Body)
+	header, err := r.Read()
+	if err != nil {
+		helpers.BadRequestResponse(c, fmt.Errorf("could not read the CSV header: %w", err))
+		return
+	}
+
+	userColumn := -1
+	columns := make(map[int]data.GradeItem)
+	for i, title := range header {
+		key := itemKeyFromHeader(title)
+		if key == "user_id" {
+			userColumn = i
+		}
+		if item, ok := items[key]; ok {
+			columns[i] = item
+		}
+	}
+	if userColumn == -1 {
+		helpers.BadRequestResponse(c, errors.New("the CSV needs a user_id column"))
+		return
+	}
+
+	var overrides []data.GradeOverride
+	var problems []string
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			helpers.BadRequestResponse(c, err)
+			return
+		}
+
+		userID, err := strconv.ParseUint(strings.TrimSpace(record[userColumn]), 10, 32)
+		student, ok := students[uint(userID)]
+		if err != nil || !ok {
+			problems = append(problems, fmt.Sprintf("line %d: %q is not a student of the course", line, record[userColumn]))
+			continue
+		}
+
+		for i, item := range columns {
+			cell := strings.TrimSpace(record[i])
+			if cell == "" {
+				continue
+			}
+			points, err := strconv.ParseFloat(cell, 64)
+			if err != nil || math.IsNaN(points) || math.IsInf(points, 0) || points < 0 || points > item.MaxPoints {
+				problems = append(problems, fmt.Sprintf("line %d: %q is not a valid score for %s", line, cell, item.Title))
+				continue
+			}
+			// Unchanged cells of an exported file keep the computed score.
+			if current := student.Entries[item.Key].Points; current != nil && *current == points {
+				continue
+			}
+			overrides = append(overrides, data.GradeOverride{CourseID: id, UserID: uint(userID), ItemKey: item.Key, Points: points})
+		}
+	}
+
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the CSV contains invalid rows", "problems": problems})
+		return
+	}
+
+	if err := h.Models.Gradebook.SaveOverrides(id, overrides); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"updated": len(overrides)})
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"lms-crud-api/internal/data"
 	"lms-crud-api/internal/helpers"
+	"lms-crud-api/middleware"
+	"lms-shared/events"
 	"net/http"
 )
 
@@ -26,6 +28,10 @@ func (h *LessonsHandler) CreateLessonHandler(c *gin.Context) {
 		return
 	}
 
+	if _, ok := authorizeModuleEdit(c, h.Models, input.ModuleID); !ok {
+		return
+	}
+
 	lesson := &data.Lesson{
 		Title:    input.Title,
 		Link:     input.Link,
@@ -33,7 +39,7 @@ func (h *LessonsHandler) CreateLessonHandler(c *gin.Context) {
 		ModuleID: input.ModuleID,
 	}
 
-	err = h.Models.Lessons.Insert(lesson)
+	err = h.Models.Lessons.Insert(lesson, revisionMeta(c))
 	if err != nil {
 		helpers.ServerErrorResponse(c, err)
 		return
@@ -41,7 +47,7 @@ func (h *LessonsHandler) CreateLessonHandler(c *gin.Context) {
 
 	moduleName := h.Models.Lessons.GetModuleName(int(lesson.ModuleID))
 	courseName := h.Models.Lessons.GetCourseNameByModuleId(int(lesson.ModuleID))
-	h.Models.Courses.SendMessageToQueue(logger, ch, c, fmt.Sprintf("New lesson: %s is added to %s module of %s course!", lesson.Title, moduleName, courseName))
+	h.Models.Courses.PublishEvent(logger, ch, c, events.LessonCreated{LessonID: lesson.ID, Title: lesson.Title, ModuleID: lesson.ModuleID, ModuleTitle: moduleName, CourseTitle: courseName})
 
 	helpers.WriteJSON(c, http.StatusCreated, gin.H{"lesson": lesson})
 }
@@ -53,11 +59,20 @@ func (h *LessonsHandler) ShowAllLessonsForModuleHandler(c *gin.Context) {
 		return
 	}
 
+	module, ok := authorizeModuleView(c, h.Models, moduleID)
+	if !ok {
+		return
+	}
+
 	lessons, err := h.Models.Lessons.GetAllForModule(moduleID)
 	if err != nil {
 		helpers.ServerErrorResponse(c, err)
 		return
 	}
+	if err := hideUnreadableLessons(h.Models, middleware.ClaimsFromContext(c), module.CourseID, lessonPointers(lessons)); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
 
 	helpers.WriteJSON(c, http.StatusOK, gin.H{"lessons": lessons})
 }
@@ -74,10 +89,152 @@ func (h *LessonsHandler) ShowLessonHandler(c *gin.Context) {
 		helpers.NotFoundResponse(c)
 		return
 	}
+	if _, ok := authorizeModuleView(c, h.Models, lesson.ModuleID); !ok {
+		return
+	}
+
+	// Only editors and enrolled students may open a lesson. Opening it
+	// starts it for students.
+	userID := middleware.ClaimsFromContext(c).UserId
+	courseID, err := h.Models.Lessons.GetCourseID(lesson)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	canEdit, enrolled, err := h.lessonAccess(c, courseID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	if !canEdit && !enrolled {
+		helpers.ForbiddenResponse(c, "Only students enrolled in the course can open its lessons")
+		return
+	}
+	if enrolled {
+		if !h.checkUnlocked(c, courseID, lesson.ID) {
+			return
+		}
+		if err := h.Models.Progress.MarkStarted(lesson.ID, userID); err != nil {
+			helpers.ServerErrorResponse(c, err)
+			return
+		}
+		progress, err := h.Models.Progress.Get(lesson.ID, userID)
+		if err != nil {
+			helpers.ServerErrorResponse(c, err)
+			return
+		}
+		lesson.Progress = progress.Status
+	}
 
 	helpers.WriteJSON(c, http.StatusOK, gin.H{"lesson": lesson})
 }
 
+// lessonAccess tells whether the caller may edit the course and whether they
+// are enrolled in it.
+func (h *LessonsHandler) lessonAccess(c *gin.Context, courseID uint) (canEdit bool, enrolled bool, err error) {
+	course, err := h.Models.Courses.Get(courseID)
+	if err != nil {
+		return false, false, err
+	}
+
+	claims := middleware.ClaimsFromContext(c)
+	canEdit, err = canEditCourse(h.Models, claims, course)
+	if err != nil {
+		return false, false, err
+	}
+	enrolled, err = h.Models.Enrollments.IsEnrolled(courseID, claims.UserId)
+	return canEdit, enrolled, err
+}
+
+// checkUnlocked makes sure the prerequisites of the lesson are met for the
+// calling student. Editors of the course are never locked out. When it
+// returns false the response has already been written.
+func (h *LessonsHandler) checkUnlocked(c *gin.Context, courseID, lessonID uint) bool {
+	course, err := h.Models.Courses.Get(courseID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return false
+	}
+	claims := middleware.ClaimsFromContext(c)
+	canEdit, err := canEditCourse(h.Models, claims, course)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return false
+	}
+	if canEdit {
+		return true
+	}
+
+	reason, err := h.Models.Prerequisites.LessonLock(courseID, lessonID, claims.UserId)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return false
+	}
+	if reason != "" {
+		helpers.ForbiddenResponse(c, reason)
+		return false
+	}
+	return true
+}
+
+func (h *LessonsHandler) CompleteLessonHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	lesson, err := h.Models.Lessons.Get(id)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	userID := middleware.ClaimsFromContext(c).UserId
+	courseID, err := h.Models.Lessons.GetCourseID(lesson)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	enrolled, err := h.Models.Enrollments.IsEnrolled(courseID, userID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	if !enrolled {
+		helpers.ForbiddenResponse(c, "Only students enrolled in the course can complete its lessons")
+		return
+	}
+	if !h.checkUnlocked(c, courseID, lesson.ID) {
+		return
+	}
+
+	before, err := h.Models.Progress.CourseCompletionPercent(courseID, userID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	progress, err := h.Models.Progress.MarkCompleted(lesson.ID, userID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	after, err := h.Models.Progress.CourseCompletionPercent(courseID, userID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	if before < 100 && after == 100 {
+		courseName := h.Models.Courses.GetCourseNameById(int(courseID))
+		h.Models.Courses.PublishEvent(logger, ch, c, events.CourseCompleted{CourseID: courseID, CourseTitle: courseName})
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"progress": progress, "course_completion_percent": after})
+}
+
 func (h *LessonsHandler) UpdateLessonHandler(c *gin.Context) {
 	id, err := helpers.ReadIDParam(c)
 	if err != nil {
@@ -97,9 +254,8 @@ func (h *LessonsHandler) UpdateLessonHandler(c *gin.Context) {
 		return
 	}
 
-	lesson, err := h.Models.Lessons.Get(id)
-	if err != nil {
-		helpers.NotFoundResponse(c)
+	lesson, ok := authorizeLessonEdit(c, h.Models, id)
+	if !ok {
 		return
 	}
 
@@ -107,7 +263,7 @@ func (h *LessonsHandler) UpdateLessonHandler(c *gin.Context) {
 	lesson.Link = input.Link
 	lesson.Conspect = input.Conspect
 
-	err = h.Models.Lessons.Update(lesson)
+	err = h.Models.Lessons.Update(lesson, revisionMeta(c))
 	if err != nil {
 		helpers.ServerErrorResponse(c, err)
 		return
@@ -115,7 +271,7 @@ func (h *LessonsHandler) UpdateLessonHandler(c *gin.Context) {
 
 	moduleName := h.Models.Lessons.GetModuleName(int(lesson.ModuleID))
 	courseName := h.Models.Lessons.GetCourseNameByModuleId(int(lesson.ModuleID))
-	h.Models.Courses.SendMessageToQueue(logger, ch, c, fmt.Sprintf("Lesson: %s is updated in %s module of %s course!", lesson.Title, moduleName, courseName))
+	h.Models.Courses.PublishEvent(logger, ch, c, events.LessonUpdated{LessonID: lesson.ID, Title: lesson.Title, ModuleID: lesson.ModuleID, ModuleTitle: moduleName, CourseTitle: courseName})
 
 	helpers.WriteJSON(c, http.StatusOK, gin.H{"lesson": lesson})
 }
@@ -127,6 +283,10 @@ func (h *LessonsHandler) DeleteLessonHandler(c *gin.Context) {
 		return
 	}
 
+	if _, ok := authorizeLessonEdit(c, h.Models, id); !ok {
+		return
+	}
+
 	err = h.Models.Lessons.Delete(id)
 	if err != nil {
 		helpers.ServerErrorResponse(c, err)
@@ -135,3 +295,129 @@ func (h *LessonsHandler) DeleteLessonHandler(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// ReorderLessonsHandler sets the order of the lessons of a module. The body
+// lists every lesson id of the module in the new order.
+func (h *LessonsHandler) ReorderLessonsHandler(c *gin.Context) {
+	moduleID, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	var input struct {
+		LessonIDs []uint `json:"lesson_ids"`
+	}
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	if _, ok := authorizeModuleEdit(c, h.Models, moduleID); !ok {
+		return
+	}
+
+	err = h.Models.Lessons.Reorder(moduleID, input.LessonIDs)
+	switch {
+	case errors.Is(err, data.ErrInvalidOrder), errors.Is(err, data.ErrPrerequisiteCycle):
+		helpers.BadRequestResponse(c, err)
+		return
+	case err != nil:
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	lessons, err := h.Models.Lessons.GetAllForModule(moduleID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"lessons": lessons})
+}
+
+// MoveLessonHandler moves a lesson to another module, or to another place in
+// its own module. Without a position the lesson goes to the end.
+func (h *LessonsHandler) MoveLessonHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	var input struct {
+		ModuleID uint `json:"module_id"`
+		Position *int `json:"position"`
+	}
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+	if input.Position != nil && *input.Position < 0 {
+		helpers.BadRequestResponse(c, errors.New("position must not be negative"))
+		return
+	}
+
+	lesson, ok := authorizeLessonEdit(c, h.Models, id)
+	if !ok {
+		return
+	}
+	if _, ok := authorizeModuleEdit(c, h.Models, input.ModuleID); !ok {
+		return
+	}
+
+	err = h.Models.Lessons.Move(lesson, input.ModuleID, input.Position)
+	switch {
+	case errors.Is(err, data.ErrPrerequisiteCycle):
+		helpers.BadRequestResponse(c, err)
+		return
+	case err != nil:
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"lesson": lesson})
+}
+
+// UpdatePrerequisitesHandler replaces the lessons that have to be completed
+// before this one opens.
+func (h *LessonsHandler) UpdatePrerequisitesHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	var input struct {
+		LessonIDs []uint `json:"lesson_ids"`
+	}
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	lesson, ok := authorizeLessonEdit(c, h.Models, id)
+	if !ok {
+		return
+	}
+	courseID, err := h.Models.Lessons.GetCourseID(lesson)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	err = h.Models.Prerequisites.SetForLesson(lesson, courseID, input.LessonIDs)
+	switch {
+	case errors.Is(err, data.ErrInvalidPrerequisite), errors.Is(err, data.ErrPrerequisiteCycle):
+		helpers.BadRequestResponse(c, err)
+		return
+	case err != nil:
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"lesson": lesson})
+}
@@ -1,10 +1,13 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"lms-crud-api/internal/data"
 	"lms-crud-api/internal/helpers"
+	"lms-crud-api/middleware"
+	"lms-shared/events"
+	"lms-shared/query"
 	"net/http"
 )
 
@@ -24,30 +27,40 @@ func (h *ModulesHandler) CreateModuleHandler(c *gin.Context) {
 		return
 	}
 
+	if _, ok := authorizeCourseEdit(c, h.Models, input.CourseID); !ok {
+		return
+	}
+
 	module := &data.Module{
 		Title:    input.Title,
 		CourseID: input.CourseID,
 	}
 
-	err = h.Models.Modules.Insert(module)
+	err = h.Models.Modules.Insert(module, revisionMeta(c))
 	if err != nil {
 		helpers.ServerErrorResponse(c, err)
 		return
 	}
 	courseName := h.Models.Courses.GetCourseNameById(int(module.CourseID))
-	h.Models.Courses.SendMessageToQueue(logger, ch, c, fmt.Sprintf("New module: %s is added to %s course!", module.Title, courseName))
+	h.Models.Courses.PublishEvent(logger, ch, c, events.ModuleCreated{ModuleID: module.ID, Title: module.Title, CourseID: module.CourseID, CourseTitle: courseName})
 
 	helpers.WriteJSON(c, http.StatusCreated, gin.H{"module": module})
 }
 
 func (h *ModulesHandler) ShowAllModulesHandler(c *gin.Context) {
-	modules, err := h.Models.Modules.GetAll() // Implement GetAll method in Modules model
+	q, err := query.Parse(c.Request.URL.Query(), data.ModuleListSpec)
+	if err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	modules, metadata, err := h.Models.Modules.GetAll(courseViewer(middleware.ClaimsFromContext(c)), q)
 	if err != nil {
 		helpers.ServerErrorResponse(c, err)
 		return
 	}
 
-	helpers.WriteJSON(c, http.StatusOK, gin.H{"modules": modules})
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"modules": modules, "metadata": metadata})
 }
 
 func (h *ModulesHandler) ShowModulesForCourseHandler(c *gin.Context) {
@@ -57,11 +70,19 @@ func (h *ModulesHandler) ShowModulesForCourseHandler(c *gin.Context) {
 		return
 	}
 
+	if _, ok := authorizeCourseView(c, h.Models, courseID); !ok {
+		return
+	}
+
 	modules, err := h.Models.Modules.GetAllWithLessonsForCourse(courseID) // Update GetAllWithLessonsForCourse to preload lessons
 	if err != nil {
 		helpers.ServerErrorResponse(c, err)
 		return
 	}
+	if err := hideUnreadableLessons(h.Models, middleware.ClaimsFromContext(c), courseID, moduleLessons(modules)); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
 
 	helpers.WriteJSON(c, http.StatusOK, gin.H{"modules": modules})
 }
@@ -73,11 +94,19 @@ func (h *ModulesHandler) ShowModuleHandler(c *gin.Context) {
 		return
 	}
 
+	if _, ok := authorizeModuleView(c, h.Models, id); !ok {
+		return
+	}
+
 	module, err := h.Models.Modules.GetWithLessons(id) // Update GetWithLessons to preload lessons
 	if err != nil {
 		helpers.NotFoundResponse(c)
 		return
 	}
+	if err := hideUnreadableLessons(h.Models, middleware.ClaimsFromContext(c), module.CourseID, lessonPointers(module.Lessons)); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
 
 	helpers.WriteJSON(c, http.StatusOK, gin.H{"module": module})
 }
@@ -99,22 +128,21 @@ func (h *ModulesHandler) UpdateModuleHandler(c *gin.Context) {
 		return
 	}
 
-	module, err := h.Models.Modules.Get(id)
-	if err != nil {
-		helpers.NotFoundResponse(c)
+	module, ok := authorizeModuleEdit(c, h.Models, id)
+	if !ok {
 		return
 	}
 
 	module.Title = input.Title
 
-	err = h.Models.Modules.Update(module)
+	err = h.Models.Modules.Update(module, revisionMeta(c))
 	if err != nil {
 		helpers.ServerErrorResponse(c, err)
 		return
 	}
 
 	courseName := h.Models.Courses.GetCourseNameById(int(module.CourseID))
-	h.Models.Courses.SendMessageToQueue(logger, ch, c, fmt.Sprintf("Module: %s is updated in %s course!", module.Title, courseName))
+	h.Models.Courses.PublishEvent(logger, ch, c, events.ModuleUpdated{ModuleID: module.ID, Title: module.Title, CourseID: module.CourseID, CourseTitle: courseName})
 
 	helpers.WriteJSON(c, http.StatusOK, gin.H{"module": module})
 }
@@ -126,6 +154,10 @@ func (h *ModulesHandler) DeleteModuleHandler(c *gin.Context) {
 		return
 	}
 
+	if _, ok := authorizeModuleEdit(c, h.Models, id); !ok {
+		return
+	}
+
 	err = h.Models.Modules.Delete(id)
 	if err != nil {
 		helpers.ServerErrorResponse(c, err)
@@ -134,3 +166,80 @@ func (h *ModulesHandler) DeleteModuleHandler(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// ReorderModulesHandler sets the order of the modules of a course. The body
+// lists every module id of the course in the new order.
+func (h *ModulesHandler) ReorderModulesHandler(c *gin.Context) {
+	courseID, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	var input struct {
+		ModuleIDs []uint `json:"module_ids"`
+	}
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	if _, ok := authorizeCourseEdit(c, h.Models, courseID); !ok {
+		return
+	}
+
+	err = h.Models.Modules.Reorder(courseID, input.ModuleIDs)
+	switch {
+	case errors.Is(err, data.ErrInvalidOrder), errors.Is(err, data.ErrPrerequisiteCycle):
+		helpers.BadRequestResponse(c, err)
+		return
+	case err != nil:
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	modules, err := h.Models.Modules.GetAllWithLessonsForCourse(courseID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"modules": modules})
+}
+
+// UpdatePrerequisitesHandler replaces the modules that have to be completed
+// before this one opens.
+func (h *ModulesHandler) UpdatePrerequisitesHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	var input struct {
+		ModuleIDs []uint `json:"module_ids"`
+	}
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	module, ok := authorizeModuleEdit(c, h.Models, id)
+	if !ok {
+		return
+	}
+
+	err = h.Models.Prerequisites.SetForModule(module, input.ModuleIDs)
+	switch {
+	case errors.Is(err, data.ErrInvalidPrerequisite), errors.Is(err, data.ErrPrerequisiteCycle):
+		helpers.BadRequestResponse(c, err)
+		return
+	case err != nil:
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"module": module})
+}
@@ -0,0 +1,507 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"lms-crud-api/internal/data"
+	"lms-crud-api/internal/helpers"
+	"lms-crud-api/middleware"
+	"lms-shared/events"
+	"net/http"
+)
+
+type QuizzesHandler struct {
+	Models data.Models
+}
+
+type quizSettingsInput struct {
+	Title            string `json:"title"`
+	MaxAttempts      int    `json:"max_attempts"`
+	TimeLimitSeconds int    `json:"time_limit_seconds"`
+	ShuffleQuestions bool   `json:"shuffle_questions"`
+	CategoryID       *uint  `json:"category_id"`
+}
+
+func (input quizSettingsInput) validate() error {
+	if input.Title == "" {
+		return errors.New("title must not be empty")
+	}
+	if input.MaxAttempts < 0 {
+		return errors.New("max_attempts must not be negative")
+	}
+	if input.TimeLimitSeconds < 0 {
+		return errors.New("time_limit_seconds must not be negative")
+	}
+	return nil
+}
+
+// quizAccess tells what the caller may do with a quiz: editors of the course
+// see the answers, enrolled students may take it.
+func (h *QuizzesHandler) quizAccess(c *gin.Context, quiz *data.Quiz) (canEdit bool, enrolled bool, err error) {
+	courseID, err := h.Models.Quizzes.GetCourseID(quiz)
+	if err != nil {
+		return false, false, err
+	}
+	course, err := h.Models.Courses.Get(courseID)
+	if err != nil {
+		return false, false, err
+	}
+
+	claims := middleware.ClaimsFromContext(c)
+	canEdit, err = canEditCourse(h.Models, claims, course)
+	if err != nil {
+		return false, false, err
+	}
+	enrolled, err = h.Models.Enrollments.IsEnrolled(courseID, claims.UserId)
+	return canEdit, enrolled, err
+}
+
+// checkQuizUnlocked makes sure the lesson or module of the quiz is unlocked
+// for the calling student, the way LessonsHandler.checkUnlocked does for
+// lessons. When it returns false the response has already been written.
+func (h *QuizzesHandler) checkQuizUnlocked(c *gin.Context, quiz *data.Quiz) bool {
+	courseID, err := h.Models.Quizzes.GetCourseID(quiz)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return false
+	}
+	access, err := loadContentAccess(h.Models, middleware.ClaimsFromContext(c), courseID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return false
+	}
+
+	var reason string
+	if quiz.LessonID != nil {
+		reason = access.lockedLessons[*quiz.LessonID]
+	} else {
+		reason = access.lockedModules[*quiz.ModuleID]
+	}
+	if reason != "" {
+		helpers.ForbiddenResponse(c, reason)
+		return false
+	}
+	return true
+}
+
+func (h *QuizzesHandler) CreateQuizHandler(c *gin.Context) {
+	var input struct {
+		quizSettingsInput
+		LessonID  *uint `json:"lesson_id"`
+		ModuleID  *uint `json:"module_id"`
+		Questions []struct {
+			Type            string   `json:"type"`
+			Prompt          string   `json:"prompt"`
+			Points          *float64 `json:"points"`
+			CorrectAnswer   string   `json:"correct_answer"`
+			AcceptedAnswers []string `json:"accepted_answers"`
+			Tolerance       float64  `json:"tolerance"`
+			Options         []struct {
+				Text    string `json:"text"`
+				Correct bool   `json:"correct"`
+			} `json:"options"`
+		} `json:"questions"`
+	}
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	if err := input.validate(); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+	if (input.LessonID == nil) == (input.ModuleID == nil) {
+		helpers.BadRequestResponse(c, errors.New("exactly one of lesson_id and module_id must be set"))
+		return
+	}
+	if len(input.Questions) == 0 {
+		helpers.BadRequestResponse(c, errors.New("a quiz needs at least one question"))
+		return
+	}
+
+	if input.LessonID != nil {
+		if _, ok := authorizeLessonEdit(c, h.Models, *input.LessonID); !ok {
+			return
+		}
+	} else {
+		if _, ok := authorizeModuleEdit(c, h.Models, *input.ModuleID); !ok {
+			return
+		}
+	}
+
+	quiz := &data.Quiz{
+		LessonID:         input.LessonID,
+		ModuleID:         input.ModuleID,
+		Title:            input.Title,
+		MaxAttempts:      input.MaxAttempts,
+		TimeLimitSeconds: input.TimeLimitSeconds,
+		ShuffleQuestions: input.ShuffleQuestions,
+		CategoryID:       input.CategoryID,
+	}
+	courseID, err := h.Models.Quizzes.GetCourseID(quiz)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	if !checkCategory(c, h.Models, quiz.CategoryID, courseID) {
+		return
+	}
+
+	for i, q := range input.Questions {
+		question := data.QuizQuestion{
+			Position:        i,
+			Type:            q.Type,
+			Prompt:          q.Prompt,
+			Points:          1,
+			CorrectAnswer:   q.CorrectAnswer,
+			AcceptedAnswers: q.AcceptedAnswers,
+			Tolerance:       q.Tolerance,
+		}
+		if q.Points != nil {
+			question.Points = *q.Points
+		}
+		for j, o := range q.Options {
+			question.Options = append(question.Options, data.QuizOption{Position: j, Text: o.Text, Correct: o.Correct})
+		}
+		if err := question.Validate(); err != nil {
+			helpers.BadRequestResponse(c, fmt.Errorf("question %d: %w", i+1, err))
+			return
+		}
+		quiz.Questions = append(quiz.Questions, question)
+	}
+
+	if err := h.Models.Quizzes.Insert(quiz); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusCreated, gin.H{"quiz": quiz})
+}
+
+func (h *QuizzesHandler) ShowQuizzesForLessonHandler(c *gin.Context) {
+	lessonID, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	lesson, err := h.Models.Lessons.Get(lessonID)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+	if _, ok := authorizeModuleView(c, h.Models, lesson.ModuleID); !ok {
+		return
+	}
+
+	quizzes, err := h.Models.Quizzes.GetAllForLesson(lessonID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"quizzes": quizzes})
+}
+
+func (h *QuizzesHandler) ShowQuizzesForModuleHandler(c *gin.Context) {
+	moduleID, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	if _, ok := authorizeModuleView(c, h.Models, moduleID); !ok {
+		return
+	}
+
+	quizzes, err := h.Models.Quizzes.GetAllForModule(moduleID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"quizzes": quizzes})
+}
+
+// ShowQuizHandler returns the quiz with its questions. Only editors of the
+// course see the answers.
+func (h *QuizzesHandler) ShowQuizHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	quiz, err := h.Models.Quizzes.Get(id)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	canEdit, enrolled, err := h.quizAccess(c, quiz)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	if !canEdit && !enrolled {
+		helpers.ForbiddenResponse(c, "Only students enrolled in the course can see this quiz")
+		return
+	}
+	if !canEdit {
+		if !h.checkQuizUnlocked(c, quiz) {
+			return
+		}
+		quiz.HideAnswers()
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"quiz": quiz})
+}
+
+func (h *QuizzesHandler) UpdateQuizHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	var input quizSettingsInput
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	if err := input.validate(); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	quiz, ok := h.authorizeQuizEdit(c, id)
+	if !ok {
+		return
+	}
+
+	quiz.Title = input.Title
+	quiz.MaxAttempts = input.MaxAttempts
+	quiz.TimeLimitSeconds = input.TimeLimitSeconds
+	quiz.ShuffleQuestions = input.ShuffleQuestions
+	quiz.CategoryID = input.CategoryID
+
+	courseID, err := h.Models.Quizzes.GetCourseID(quiz)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	if !checkCategory(c, h.Models, quiz.CategoryID, courseID) {
+		return
+	}
+
+	if err := h.Models.Quizzes.UpdateSettings(quiz); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"quiz": quiz})
+}
+
+func (h *QuizzesHandler) DeleteQuizHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	if _, ok := h.authorizeQuizEdit(c, id); !ok {
+		return
+	}
+
+	if err := h.Models.Quizzes.Delete(id); err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *QuizzesHandler) authorizeQuizEdit(c *gin.Context, id uint) (*data.Quiz, bool) {
+	quiz, err := h.Models.Quizzes.Get(id)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return nil, false
+	}
+
+	canEdit, _, err := h.quizAccess(c, quiz)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return nil, false
+	}
+	if !canEdit {
+		helpers.ForbiddenResponse(c, "Only the course owner and its collaborators can edit this quiz")
+		return nil, false
+	}
+	return quiz, true
+}
+
+// StartAttemptHandler opens an attempt and returns the questions in the order
+// of the attempt, without answers.
+func (h *QuizzesHandler) StartAttemptHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	quiz, err := h.Models.Quizzes.Get(id)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	_, enrolled, err := h.quizAccess(c, quiz)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	if !enrolled {
+		helpers.ForbiddenResponse(c, "Only students enrolled in the course can take this quiz")
+		return
+	}
+	if !h.checkQuizUnlocked(c, quiz) {
+		return
+	}
+
+	attempt, err := h.Models.Quizzes.StartAttempt(quiz.ID, middleware.ClaimsFromContext(c).UserId)
+	if err == data.ErrNoAttemptsLeft {
+		helpers.ConflictResponse(c, err)
+		return
+	}
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	quiz.OrderQuestions(attempt.QuestionOrder)
+	quiz.HideAnswers()
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"attempt": attempt, "questions": quiz.Questions})
+}
+
+func (h *QuizzesHandler) SubmitAttemptHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	var input struct {
+		Answers []data.SubmittedAnswer `json:"answers"`
+	}
+
+	if err := c.BindJSON(&input); err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	attempt, err := h.Models.Quizzes.GetAttempt(id)
+	if err != nil || attempt.UserID != middleware.ClaimsFromContext(c).UserId {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	quiz, err := h.Models.Quizzes.Get(attempt.QuizID)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+	if !h.checkQuizUnlocked(c, quiz) {
+		return
+	}
+
+	attempt, err = h.Models.Quizzes.SubmitAttempt(attempt.ID, input.Answers)
+	switch err {
+	case nil:
+	case data.ErrAttemptSubmitted, data.ErrAttemptExpired:
+		helpers.ConflictResponse(c, err)
+		return
+	default:
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	h.Models.Courses.PublishEvent(logger, ch, c, events.QuizAttemptScored{QuizID: quiz.ID, QuizTitle: quiz.Title, Score: attempt.Score, MaxScore: attempt.MaxScore})
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"attempt": attempt})
+}
+
+func (h *QuizzesHandler) ShowMyAttemptsHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	attempts, err := h.Models.Quizzes.GetAttemptsForUser(id, middleware.ClaimsFromContext(c).UserId)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"attempts": attempts})
+}
+
+// ReviewAttemptHandler shows a submitted attempt with the given answers and
+// the correct ones. Students see their own attempts, editors of the course
+// see everyone's. Students only get the correct answers once they have used
+// up all their attempts.
+func (h *QuizzesHandler) ReviewAttemptHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	attempt, err := h.Models.Quizzes.GetAttempt(id)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	quiz, err := h.Models.Quizzes.Get(attempt.QuizID)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	canEdit, _, err := h.quizAccess(c, quiz)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	if attempt.UserID != middleware.ClaimsFromContext(c).UserId && !canEdit {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	if attempt.SubmittedAt == nil {
+		helpers.ConflictResponse(c, data.ErrAttemptNotSubmitted)
+		return
+	}
+
+	if !canEdit {
+		attempts, err := h.Models.Quizzes.GetAttemptsForUser(quiz.ID, attempt.UserID)
+		if err != nil {
+			helpers.ServerErrorResponse(c, err)
+			return
+		}
+		if !quiz.AnswersRevealed(len(attempts)) {
+			quiz.HideAnswers()
+		}
+	}
+
+	quiz.OrderQuestions(attempt.QuestionOrder)
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"attempt": attempt, "questions": quiz.Questions})
+}
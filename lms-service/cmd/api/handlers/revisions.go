@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"lms-crud-api/internal/data"
+	"lms-crud-api/internal/helpers"
+	"lms-crud-api/middleware"
+	"net/http"
+	"strconv"
+)
+
+// RevisionsHandler serves the revision history of courses, modules and
+// lessons. Each route is bound to one entity type.
+type RevisionsHandler struct {
+	Models data.Models
+}
+
+// revisionMeta records the caller as the author of an edit.
+func revisionMeta(c *gin.Context) data.RevisionMeta {
+	claims := middleware.ClaimsFromContext(c)
+	return data.RevisionMeta{AuthorID: claims.UserId, AuthorEmail: claims.Email}
+}
+
+// authorizeRevisioned loads the entity named by the id parameter and checks
+// edit rights on it. When it returns false the response has already been
+// written.
+func (h *RevisionsHandler) authorizeRevisioned(c *gin.Context, entityType string) (data.Revisioned, bool) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return nil, false
+	}
+
+	switch entityType {
+	case data.RevisionCourse:
+		if course, ok := authorizeCourseEdit(c, h.Models, id); ok {
+			return course, true
+		}
+	case data.RevisionModule:
+		if module, ok := authorizeModuleEdit(c, h.Models, id); ok {
+			return module, true
+		}
+	case data.RevisionLesson:
+		if lesson, ok := authorizeLessonEdit(c, h.Models, id); ok {
+			return lesson, true
+		}
+	}
+	return nil, false
+}
+
+func (h *RevisionsHandler) ShowRevisionsHandler(entityType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entity, ok := h.authorizeRevisioned(c, entityType)
+		if !ok {
+			return
+		}
+
+		revisions, err := h.Models.Revisions.GetAll(entity)
+		if err != nil {
+			helpers.ServerErrorResponse(c, err)
+			return
+		}
+
+		helpers.WriteJSON(c, http.StatusOK, gin.H{"revisions": revisions})
+	}
+}
+
+// DiffRevisionsHandler compares the versions given by the from and to query
+// parameters.
+func (h *RevisionsHandler) DiffRevisionsHandler(entityType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, errFrom := strconv.Atoi(c.Query("from"))
+		to, errTo := strconv.Atoi(c.Query("to"))
+		if errFrom != nil || errTo != nil {
+			helpers.BadRequestResponse(c, errors.New("from and to must be revision versions"))
+			return
+		}
+
+		entity, ok := h.authorizeRevisioned(c, entityType)
+		if !ok {
+			return
+		}
+
+		fromRevision, err := h.Models.Revisions.Get(entity, from)
+		if err != nil {
+			h.revisionError(c, err)
+			return
+		}
+		toRevision, err := h.Models.Revisions.Get(entity, to)
+		if err != nil {
+			h.revisionError(c, err)
+			return
+		}
+
+		helpers.WriteJSON(c, http.StatusOK, gin.H{
+			"from":    fromRevision,
+			"to":      toRevision,
+			"changes": data.Diff(fromRevision, toRevision),
+		})
+	}
+}
+
+// RestoreRevisionHandler brings back the content of an older version.
+func (h *RevisionsHandler) RestoreRevisionHandler(entityType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		version, err := strconv.Atoi(c.Param("version"))
+		if err != nil {
+			helpers.NotFoundResponse(c)
+			return
+		}
+
+		entity, ok := h.authorizeRevisioned(c, entityType)
+		if !ok {
+			return
+		}
+
+		if err := h.Models.Revisions.Restore(entity, version, revisionMeta(c)); err != nil {
+			h.revisionError(c, err)
+			return
+		}
+
+		helpers.WriteJSON(c, http.StatusOK, gin.H{entityType: entity})
+	}
+}
+
+func (h *RevisionsHandler) revisionError(c *gin.Context, err error) {
+	if errors.Is(err, data.ErrRevisionNotFound) {
+		helpers.NotFoundResponse(c)
+		return
+	}
+	helpers.ServerErrorResponse(c, err)
+}
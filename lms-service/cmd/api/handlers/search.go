@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"lms-crud-api/internal/data"
+	"lms-crud-api/internal/helpers"
+	"lms-crud-api/middleware"
+	"lms-shared/query"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type SearchHandler struct {
+	Models data.Models
+}
+
+// SearchContentHandler searches the courses, modules and lessons the caller may see.
+// q is the search text; type and course_id narrow the results. Lessons the
+// caller may not open are only quoted by their title.
+func (h *SearchHandler) SearchContentHandler(c *gin.Context) {
+	text := strings.TrimSpace(c.Query("q"))
+	if text == "" {
+		helpers.BadRequestResponse(c, errors.New("q must not be empty"))
+		return
+	}
+
+	var filter data.SearchFilter
+	switch filter.Type = c.Query("type"); filter.Type {
+	case "", "course", "module", "lesson":
+	default:
+		helpers.BadRequestResponse(c, errors.New("type must be course, module or lesson"))
+		return
+	}
+	if v := c.Query("course_id"); v != "" {
+		courseID, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			helpers.BadRequestResponse(c, errors.New("course_id must be a number"))
+			return
+		}
+		filter.CourseID = uint(courseID)
+	}
+
+	q, err := query.Parse(c.Request.URL.Query(), query.Spec{})
+	if err != nil {
+		helpers.BadRequestResponse(c, err)
+		return
+	}
+
+	claims := middleware.ClaimsFromContext(c)
+	results, total, err := h.Models.Search.Search(text, filter, courseViewer(claims), q.Limit, q.Offset())
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	accesses := make(map[uint]*contentAccess)
+	for i := range results {
+		result := &results[i]
+		if result.Type != "lesson" {
+			continue
+		}
+		access, ok := accesses[result.CourseID]
+		if !ok {
+			access, err = loadContentAccess(h.Models, claims, result.CourseID)
+			if err != nil {
+				helpers.ServerErrorResponse(c, err)
+				return
+			}
+			accesses[result.CourseID] = access
+		}
+		if !access.canOpenLesson(result.ID) {
+			result.HideContent()
+		}
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"results": results, "metadata": q.Describe(total)})
+}
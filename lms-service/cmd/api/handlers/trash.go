@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"lms-crud-api/internal/data"
+	"lms-crud-api/internal/helpers"
+	"lms-crud-api/middleware"
+	"net/http"
+)
+
+type TrashHandler struct {
+	Models data.Models
+}
+
+// ShowTrashHandler lists the deleted content of the courses the caller may
+// edit.
+func (h *TrashHandler) ShowTrashHandler(c *gin.Context) {
+	items, err := h.Models.Trash.GetAll(courseViewer(middleware.ClaimsFromContext(c)))
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	helpers.WriteJSON(c, http.StatusOK, gin.H{"trash": items})
+}
+
+// RestoreHandler takes a course, module or lesson out of the trash. Like
+// deleting, restoring a course is reserved to its owner.
+func (h *TrashHandler) RestoreHandler(c *gin.Context) {
+	id, err := helpers.ReadIDParam(c)
+	if err != nil {
+		helpers.NotFoundResponse(c)
+		return
+	}
+
+	item, err := h.Models.Trash.Get(c.Param("type"), id)
+	if err != nil {
+		if errors.Is(err, data.ErrNotInTrash) {
+			helpers.NotFoundResponse(c)
+			return
+		}
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	course, err := h.Models.Courses.GetIncludingDeleted(item.CourseID)
+	if err != nil {
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+	claims := middleware.ClaimsFromContext(c)
+	if item.Type == data.TrashCourse {
+		if !isCourseOwner(claims, course) {
+			helpers.ForbiddenResponse(c, "Only the course owner can restore this course")
+			return
+		}
+	} else {
+		allowed, err := canEditCourse(h.Models, claims, course)
+		if err != nil {
+			helpers.ServerErrorResponse(c, err)
+			return
+		}
+		if !allowed {
+			helpers.ForbiddenResponse(c, "Only the course owner and its collaborators can edit this course")
+			return
+		}
+	}
+
+	err = h.Models.Trash.Restore(item)
+	switch {
+	case errors.Is(err, data.ErrParentDeleted):
+		helpers.ConflictResponse(c, err)
+		return
+	case err != nil:
+		helpers.ServerErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"lms-shared/events"
+	"time"
+)
+
+// publishScheduledCourses publishes the courses whose publish time has come
+// and notifies whoever scheduled them, checking every interval until the
+// process exits.
+func (app *application) publishScheduledCourses(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		courses, err := app.models.Courses.PublishDue(now)
+		if err != nil {
+			app.logger.Error().Err(err).Msg("Failed to publish scheduled courses")
+			continue
+		}
+		for _, course := range courses {
+			app.logger.Info().Msgf("Published scheduled course %d (%s)", course.ID, course.Title)
+			if course.ScheduledBy == "" {
+				continue
+			}
+			app.models.Courses.PublishEventToUser(app.logger, app.ch, course.ScheduledBy, course.ScheduledByLanguage, events.CoursePublished{CourseID: course.ID, Title: course.Title})
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"time"
+
+	"lms-crud-api/internal/storage"
+)
+
+// purgeTrash permanently deletes content that has been in the trash for
+// longer than retention, checking every interval until the process exits.
+func (app *application) purgeTrash(interval, retention time.Duration, uploads storage.Storage) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		purged, storageKeys, err := app.models.Trash.Purge(now.Add(-retention))
+		if err != nil {
+			app.logger.Error().Err(err).Msg("Failed to purge the trash")
+			continue
+		}
+		for _, key := range storageKeys {
+			if err := uploads.Delete(key); err != nil {
+				app.logger.Error().Err(err).Msgf("Failed to delete file %s", key)
+			}
+		}
+		if purged > 0 {
+			app.logger.Info().Msgf("Purged %d items from the trash", purged)
+		}
+	}
+}
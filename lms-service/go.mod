@@ -11,6 +11,7 @@ require (
 	github.com/rs/zerolog v1.33.0
 	github.com/streadway/amqp v1.1.0
 	gorm.io/gorm v1.25.10
+	lms-shared v0.0.0
 )
 
 require (
@@ -57,3 +58,5 @@ require (
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+replace lms-shared => ../shared
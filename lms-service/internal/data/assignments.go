@@ -0,0 +1,282 @@
+package data
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	ErrSubmissionClosed   = errors.New("the due date has passed and late submissions are not accepted")
+	ErrResubmissionDenied = errors.New("the assignment has already been submitted")
+	ErrSubmissionGraded   = errors.New("the submission has already been graded")
+)
+
+// Assignment is homework handed in for a module. MaxFiles and
+// MaxFileSizeBytes only apply when files are allowed; an empty
+// AllowedExtensions list accepts any file type.
+type Assignment struct {
+	gorm.Model
+	ModuleID          uint
+	Title             string
+	Description       string
+	DueAt             *time.Time
+	MaxPoints         float64
+	AllowLate         bool
+	AllowResubmission bool
+	AllowText         bool
+	AllowFiles        bool
+	MaxFiles          int
+	MaxFileSizeBytes  int64
+	AllowedExtensions StringList
+	CategoryID        *uint
+	Rubric            []RubricCriterion
+}
+
+// RubricCriterion is one line of the grading rubric of an assignment.
+type RubricCriterion struct {
+	ID           uint `gorm:"primary_key"`
+	AssignmentID uint
+	Position     int
+	Title        string
+	MaxPoints    float64
+}
+
+func (RubricCriterion) TableName() string {
+	return "rubric_criteria"
+}
+
+// Submission is the latest hand-in of a student for an assignment.
+type Submission struct {
+	ID           uint `gorm:"primary_key"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	AssignmentID uint
+	UserID       uint
+	Email        string
+	// Language is the preferred language of the student when they
+	// submitted, used to notify them about the grade.
+	Language     string `json:"-"`
+	Text         string
+	SubmittedAt  time.Time
+	Late         bool
+	Grade        *float64
+	Feedback     string
+	GradedAt     *time.Time
+	GradedBy     *uint
+	Files        []SubmissionFile
+	RubricScores []RubricScore
+}
+
+type SubmissionFile struct {
+	ID           uint `gorm:"primary_key"`
+	SubmissionID uint
+	FileName     string
+	ContentType  string
+	Size         int64
+	StorageKey   string `json:"-"`
+}
+
+type RubricScore struct {
+	ID           uint `gorm:"primary_key"`
+	SubmissionID uint
+	CriterionID  uint
+	Points       float64
+	Comment      string
+}
+
+// AcceptsExtension reports whether files named name may be uploaded.
+func (a *Assignment) AcceptsExtension(name string) bool {
+	if len(a.AllowedExtensions) == 0 {
+		return true
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	for _, allowed := range a.AllowedExtensions {
+		if strings.ToLower(strings.TrimPrefix(allowed, ".")) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLate reports whether a submission at t is past the due date.
+func (a *Assignment) IsLate(t time.Time) bool {
+	return a.DueAt != nil && t.After(*a.DueAt)
+}
+
+type AssignmentModel struct {
+	DB *gorm.DB
+}
+
+func preloadRubric(db *gorm.DB) *gorm.DB {
+	return db.Preload("Rubric", func(db *gorm.DB) *gorm.DB {
+		return db.Order("rubric_criteria.position, rubric_criteria.id")
+	})
+}
+
+// Insert creates the assignment together with its rubric.
+func (m AssignmentModel) Insert(assignment *Assignment) error {
+	return m.DB.Create(assignment).Error
+}
+
+func (m AssignmentModel) Get(id uint) (*Assignment, error) {
+	var assignment Assignment
+	if err := preloadRubric(m.DB).First(&assignment, id).Error; err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+func (m AssignmentModel) GetAllForModule(moduleID uint) ([]Assignment, error) {
+	var assignments []Assignment
+	if err := preloadRubric(m.DB).Where("module_id = ?", moduleID).Order("due_at, id").Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+// Update saves the assignment settings. The rubric is replaced only when
+// rubric is not nil, and never once submissions were graded with it.
+func (m AssignmentModel) Update(assignment *Assignment, rubric []RubricCriterion) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Assignment{}).Where("id = ?", assignment.ID).Updates(map[string]interface{}{
+			"title":               assignment.Title,
+			"description":         assignment.Description,
+			"due_at":              assignment.DueAt,
+			"max_points":          assignment.MaxPoints,
+			"allow_late":          assignment.AllowLate,
+			"allow_resubmission":  assignment.AllowResubmission,
+			"allow_text":          assignment.AllowText,
+			"allow_files":         assignment.AllowFiles,
+			"max_files":           assignment.MaxFiles,
+			"max_file_size_bytes": assignment.MaxFileSizeBytes,
+			"allowed_extensions":  assignment.AllowedExtensions,
+			"category_id":         assignment.CategoryID,
+		}).Error; err != nil {
+			return err
+		}
+		if rubric == nil {
+			return nil
+		}
+
+		var graded int
+		if err := tx.Model(&Submission{}).Where("assignment_id = ? AND graded_at IS NOT NULL", assignment.ID).Count(&graded).Error; err != nil {
+			return err
+		}
+		if graded > 0 {
+			return ErrSubmissionGraded
+		}
+
+		if err := tx.Where("assignment_id = ?", assignment.ID).Delete(&RubricCriterion{}).Error; err != nil {
+			return err
+		}
+		for i := range rubric {
+			rubric[i].AssignmentID = assignment.ID
+			if err := tx.Create(&rubric[i]).Error; err != nil {
+				return err
+			}
+		}
+		assignment.Rubric = rubric
+		return nil
+	})
+}
+
+func (m AssignmentModel) Delete(id uint) error {
+	return m.DB.Delete(&Assignment{}, id).Error
+}
+
+func preloadSubmission(db *gorm.DB) *gorm.DB {
+	return db.Preload("Files").Preload("RubricScores")
+}
+
+func (m AssignmentModel) GetSubmission(id uint) (*Submission, error) {
+	var submission Submission
+	if err := preloadSubmission(m.DB).First(&submission, id).Error; err != nil {
+		return nil, err
+	}
+	return &submission, nil
+}
+
+func (m AssignmentModel) GetSubmissionForUser(assignmentID, userID uint) (*Submission, error) {
+	var submission Submission
+	err := preloadSubmission(m.DB).Where("assignment_id = ? AND user_id = ?", assignmentID, userID).First(&submission).Error
+	if err != nil {
+		return nil, err
+	}
+	return &submission, nil
+}
+
+func (m AssignmentModel) GetSubmissionsForAssignment(assignmentID uint) ([]Submission, error) {
+	var submissions []Submission
+	if err := preloadSubmission(m.DB).Where("assignment_id = ?", assignmentID).Order("submitted_at").Find(&submissions).Error; err != nil {
+		return nil, err
+	}
+	return submissions, nil
+}
+
+// SaveSubmission stores a new hand-in or replaces the previous one of the
+// same student. It returns the files of the replaced hand-in so the caller
+// can remove them from storage.
+func (m AssignmentModel) SaveSubmission(assignment *Assignment, submission *Submission) ([]SubmissionFile, error) {
+	var replaced []SubmissionFile
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var existing Submission
+		err := tx.Set("gorm:query_option", "FOR UPDATE").
+			Where("assignment_id = ? AND user_id = ?", submission.AssignmentID, submission.UserID).
+			First(&existing).Error
+		switch {
+		case gorm.IsRecordNotFoundError(err):
+			return tx.Create(submission).Error
+		case err != nil:
+			return err
+		}
+
+		if existing.GradedAt != nil {
+			return ErrSubmissionGraded
+		}
+		if !assignment.AllowResubmission {
+			return ErrResubmissionDenied
+		}
+
+		if err := tx.Where("submission_id = ?", existing.ID).Find(&replaced).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("submission_id = ?", existing.ID).Delete(&SubmissionFile{}).Error; err != nil {
+			return err
+		}
+
+		submission.ID = existing.ID
+		submission.CreatedAt = existing.CreatedAt
+		return tx.Save(submission).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return replaced, nil
+}
+
+// GradeSubmission stores the grade and the rubric scores of a submission.
+func (m AssignmentModel) GradeSubmission(submission *Submission, scores []RubricScore) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("submission_id = ?", submission.ID).Delete(&RubricScore{}).Error; err != nil {
+			return err
+		}
+		for i := range scores {
+			scores[i].SubmissionID = submission.ID
+			if err := tx.Create(&scores[i]).Error; err != nil {
+				return err
+			}
+		}
+		submission.RubricScores = scores
+
+		return tx.Model(&Submission{ID: submission.ID}).Updates(map[string]interface{}{
+			"grade":     submission.Grade,
+			"feedback":  submission.Feedback,
+			"graded_at": submission.GradedAt,
+			"graded_by": submission.GradedBy,
+		}).Error
+	})
+}
@@ -0,0 +1,43 @@
+package data
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// CourseCollaborator grants a co-instructor the right to edit a course, its
+// modules and its lessons. Only the owner may delete the course or manage
+// its collaborators.
+type CourseCollaborator struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	CourseID  uint
+	UserID    uint
+}
+
+type CollaboratorModel struct {
+	DB *gorm.DB
+}
+
+func (m CollaboratorModel) Insert(collaborator *CourseCollaborator) error {
+	return m.DB.Create(collaborator).Error
+}
+
+func (m CollaboratorModel) Delete(courseID, userID uint) error {
+	return m.DB.Where("course_id = ? AND user_id = ?", courseID, userID).Delete(&CourseCollaborator{}).Error
+}
+
+func (m CollaboratorModel) GetAllForCourse(courseID uint) ([]CourseCollaborator, error) {
+	var collaborators []CourseCollaborator
+	if err := m.DB.Where("course_id = ?", courseID).Order("id").Find(&collaborators).Error; err != nil {
+		return nil, err
+	}
+	return collaborators, nil
+}
+
+func (m CollaboratorModel) Exists(courseID, userID uint) (bool, error) {
+	var count int
+	err := m.DB.Model(&CourseCollaborator{}).Where("course_id = ? AND user_id = ?", courseID, userID).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	CourseDraft     = "draft"
+	CourseInReview  = "review"
+	CoursePublished = "published"
+	CourseArchived  = "archived"
+)
+
+var (
+	ErrInvalidTransition  = errors.New("the course cannot move to this status")
+	ErrCourseStatusChange = errors.New("the status of the course was changed in the meantime")
+	ErrCourseNotPublished = errors.New("the course is not published")
+)
+
+// courseTransitions lists the allowed status changes. Authors move their
+// courses between draft and review; only publishers may publish, unpublish
+// and archive.
+var courseTransitions = map[string]map[string]bool{
+	CourseDraft: {
+		CourseInReview:  false,
+		CoursePublished: true,
+	},
+	CourseInReview: {
+		CourseDraft:     false,
+		CoursePublished: true,
+	},
+	CoursePublished: {
+		CourseDraft:    true,
+		CourseArchived: true,
+	},
+	CourseArchived: {
+		CourseDraft:     true,
+		CoursePublished: true,
+	},
+}
+
+// CourseTransition checks that a course may move from one status to another
+// and reports whether that takes the publish permission.
+func CourseTransition(from, to string) (publisherOnly bool, err error) {
+	publisherOnly, ok := courseTransitions[from][to]
+	if !ok {
+		return false, ErrInvalidTransition
+	}
+	return publisherOnly, nil
+}
+
+// CourseViewer is the user courses are listed for. Publishers see every
+// course, everybody else published courses, the courses they author and the
+// archived courses they were enrolled in.
+type CourseViewer struct {
+	UserID    uint
+	Publisher bool
+}
+
+// condition returns the SQL condition on the courses table selecting the
+// courses the viewer may see.
+func (v CourseViewer) condition() (string, []interface{}) {
+	if v.Publisher {
+		return "TRUE", nil
+	}
+	return `(courses.status = ?
+		OR courses.owner_id = ?
+		OR courses.id IN (SELECT course_id FROM course_collaborators WHERE user_id = ?)
+		OR (courses.status = ? AND courses.id IN (SELECT course_id FROM enrollments WHERE user_id = ?)))`,
+		[]interface{}{CoursePublished, v.UserID, v.UserID, CourseArchived, v.UserID}
+}
+
+func (v CourseViewer) scope(db *gorm.DB) *gorm.DB {
+	if v.Publisher {
+		return db
+	}
+	condition, args := v.condition()
+	return db.Where(condition, args...)
+}
+
+// SetStatus moves the course to status. A publishAt in the future keeps the
+// course in review until the scheduled publisher picks it up and notifies
+// the caller, identified by email and language, that it went out.
+func (m CourseModel) SetStatus(course *Course, status string, publishAt *time.Time, email, language string) error {
+	now := time.Now()
+	scheduled := publishAt != nil && publishAt.After(now)
+	if scheduled {
+		status = CourseInReview
+	} else {
+		publishAt = nil
+		email, language = "", ""
+	}
+
+	updates := map[string]interface{}{
+		"status":                status,
+		"publish_at":            publishAt,
+		"scheduled_by":          email,
+		"scheduled_by_language": language,
+	}
+	if status == CoursePublished {
+		updates["published_at"] = now
+	}
+
+	result := m.DB.Model(&Course{}).Where("id = ? AND status = ?", course.ID, course.Status).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCourseStatusChange
+	}
+
+	course.Status = status
+	course.PublishAt = publishAt
+	course.ScheduledBy = email
+	course.ScheduledByLanguage = language
+	if status == CoursePublished {
+		course.PublishedAt = &now
+	}
+	return nil
+}
+
+// PublishDue publishes the courses in review whose publish time has come and
+// returns them.
+func (m CourseModel) PublishDue(now time.Time) ([]Course, error) {
+	var courses []Course
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+			Where("status = ? AND publish_at <= ?", CourseInReview, now).
+			Find(&courses).Error
+		if err != nil || len(courses) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(courses))
+		for i := range courses {
+			ids[i] = courses[i].ID
+			courses[i].Status = CoursePublished
+			courses[i].PublishAt = nil
+			courses[i].PublishedAt = &now
+		}
+		return tx.Model(&Course{}).Where("id IN (?)", ids).Updates(map[string]interface{}{
+			"status":       CoursePublished,
+			"publish_at":   nil,
+			"published_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return courses, nil
+}
@@ -1,6 +1,8 @@
 package data
 
 import (
+	"time"
+
 	"github.com/jinzhu/gorm"
 )
 
@@ -8,15 +10,40 @@ type Course struct {
 	gorm.Model
 	Title       string
 	Description string
-	Modules     []Module
+	OwnerID     uint
+	// Status is one of CourseDraft, CourseInReview, CoursePublished and
+	// CourseArchived. PublishAt schedules a course in review for publishing.
+	Status      string
+	PublishAt   *time.Time
+	PublishedAt *time.Time
+	// ScheduledBy is the email of whoever scheduled the course, who is
+	// notified in their language once it is published.
+	ScheduledBy         string `json:"-"`
+	ScheduledByLanguage string `json:"-"`
+	// Capacity limits the number of enrolled students; nil means unlimited.
+	Capacity           *int
+	EnrollmentOpensAt  *time.Time
+	EnrollmentClosesAt *time.Time
+	// Sequential locks every lesson until the previous one is completed.
+	Sequential bool
+	Modules    []Module
+	// CompletionPercent is filled in for the calling user, see
+	// ProgressModel.ApplyToCourse.
+	CompletionPercent *float64 `gorm:"-" json:",omitempty"`
 }
 
 type CourseModel struct {
 	DB *gorm.DB
 }
 
-func (m CourseModel) Insert(course *Course) error {
-	return m.DB.Create(course).Error
+// Insert creates the course and records its first revision.
+func (m CourseModel) Insert(course *Course, meta RevisionMeta) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(course).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, course, meta)
+	})
 }
 
 func (m CourseModel) Get(id uint) (*Course, error) {
@@ -28,12 +55,37 @@ func (m CourseModel) Get(id uint) (*Course, error) {
 	return &course, nil
 }
 
-func (m CourseModel) Update(course *Course) error {
-	return m.DB.Save(course).Error
+// Update saves the course and records the edit as a revision. The status
+// only changes through SetStatus and PublishDue.
+// GetIncludingDeleted also finds courses that are in the trash.
+func (m CourseModel) GetIncludingDeleted(id uint) (*Course, error) {
+	var course Course
+	if err := m.DB.Unscoped().First(&course, id).Error; err != nil {
+		return nil, err
+	}
+	return &course, nil
+}
+
+// Update saves the course with a revision. Making the course sequential
+// fails with ErrPrerequisiteCycle when a lesson would have to wait for a
+// later one.
+func (m CourseModel) Update(course *Course, meta RevisionMeta) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := saveWithRevision(tx, course, meta); err != nil {
+			return err
+		}
+		if !course.Sequential {
+			return nil
+		}
+		return checkPrerequisiteCycles(tx, course.ID)
+	})
 }
 
+// Delete moves the course with its modules and lessons to the trash.
 func (m CourseModel) Delete(id uint) error {
-	return m.DB.Delete(&Course{}, id).Error
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteCourse(tx, id, time.Now())
+	})
 }
 
 func (m CourseModel) GetCourseNameById(courseId int) string {
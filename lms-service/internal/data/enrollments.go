@@ -0,0 +1,127 @@
+package data
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	ErrAlreadyEnrolled  = errors.New("already enrolled in this course")
+	ErrNotEnrolled      = errors.New("not enrolled in this course")
+	ErrCourseFull       = errors.New("the course has no free places")
+	ErrEnrollmentClosed = errors.New("enrollment for this course is closed")
+)
+
+// Enrollment links a student to a course. The email is kept so the roster
+// and notifications do not depend on the authentication service.
+type Enrollment struct {
+	ID        uint `gorm:"primary_key"`
+	CreatedAt time.Time
+	CourseID  uint
+	UserID    uint
+	Email     string
+}
+
+type EnrollmentModel struct {
+	DB *gorm.DB
+}
+
+// EnrollmentOpen reports whether students can enroll in the course at t.
+func (c *Course) EnrollmentOpen(t time.Time) bool {
+	if c.EnrollmentOpensAt != nil && t.Before(*c.EnrollmentOpensAt) {
+		return false
+	}
+	if c.EnrollmentClosesAt != nil && !t.Before(*c.EnrollmentClosesAt) {
+		return false
+	}
+	return true
+}
+
+// Enroll adds the user to the course. The course row is locked while the
+// places are counted, so concurrent enrollments cannot exceed the capacity.
+func (m EnrollmentModel) Enroll(courseID, userID uint, email string) (*Enrollment, error) {
+	enrollment := &Enrollment{CourseID: courseID, UserID: userID, Email: email}
+
+	tx := m.DB.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer tx.Rollback()
+
+	var course Course
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&course, courseID).Error; err != nil {
+		return nil, err
+	}
+	if course.Status != CoursePublished {
+		return nil, ErrCourseNotPublished
+	}
+	if !course.EnrollmentOpen(time.Now()) {
+		return nil, ErrEnrollmentClosed
+	}
+
+	var existing int
+	if err := tx.Model(&Enrollment{}).Where("course_id = ? AND user_id = ?", courseID, userID).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrAlreadyEnrolled
+	}
+
+	if course.Capacity != nil {
+		var enrolled int
+		if err := tx.Model(&Enrollment{}).Where("course_id = ?", courseID).Count(&enrolled).Error; err != nil {
+			return nil, err
+		}
+		if enrolled >= *course.Capacity {
+			return nil, ErrCourseFull
+		}
+	}
+
+	if err := tx.Create(enrollment).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return enrollment, nil
+}
+
+func (m EnrollmentModel) Delete(courseID, userID uint) error {
+	result := m.DB.Where("course_id = ? AND user_id = ?", courseID, userID).Delete(&Enrollment{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotEnrolled
+	}
+	return nil
+}
+
+func (m EnrollmentModel) GetAllForCourse(courseID uint) ([]Enrollment, error) {
+	var enrollments []Enrollment
+	if err := m.DB.Where("course_id = ?", courseID).Order("created_at").Find(&enrollments).Error; err != nil {
+		return nil, err
+	}
+	return enrollments, nil
+}
+
+func (m EnrollmentModel) IsEnrolled(courseID, userID uint) (bool, error) {
+	var count int
+	err := m.DB.Model(&Enrollment{}).Where("course_id = ? AND user_id = ?", courseID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// GetCoursesForUser returns the courses the user is enrolled in.
+func (m EnrollmentModel) GetCoursesForUser(userID uint) ([]Course, error) {
+	var courses []Course
+	err := m.DB.Joins("JOIN enrollments ON enrollments.course_id = courses.id").
+		Where("enrollments.user_id = ?", userID).
+		Order("enrollments.created_at").
+		Find(&courses).Error
+	if err != nil {
+		return nil, err
+	}
+	return courses, nil
+}
@@ -0,0 +1,504 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	GradeItemQuiz       = "quiz"
+	GradeItemAssignment = "assignment"
+)
+
+// GradeCategory groups gradebook items, e.g. "Homework" or "Exams". The
+// final grade is the weighted average of the category percentages.
+type GradeCategory struct {
+	ID         uint `gorm:"primary_key"`
+	CourseID   uint
+	Name       string
+	Weight     float64
+	DropLowest int
+}
+
+// LetterGrade is reached from MinPercent upwards.
+type LetterGrade struct {
+	Letter     string  `json:"letter"`
+	MinPercent float64 `json:"min_percent"`
+}
+
+// LetterScale is stored as a JSON array in a text column.
+type LetterScale []LetterGrade
+
+func (s LetterScale) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+func (s *LetterScale) Scan(src interface{}) error {
+	return scanJSON(src, s)
+}
+
+// Letter returns the letter for percent, or "" when the scale is empty.
+func (s LetterScale) Letter(percent float64) string {
+	sorted := append(LetterScale(nil), s...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].MinPercent > sorted[j].MinPercent })
+	for _, grade := range sorted {
+		if percent >= grade.MinPercent {
+			return grade.Letter
+		}
+	}
+	return ""
+}
+
+var DefaultLetterScale = LetterScale{
+	{Letter: "A", MinPercent: 90},
+	{Letter: "B", MinPercent: 80},
+	{Letter: "C", MinPercent: 70},
+	{Letter: "D", MinPercent: 60},
+	{Letter: "F", MinPercent: 0},
+}
+
+// GradebookSettings configures how the grades of a course are calculated.
+// Late submissions lose LatePenaltyPerDay percent of their points for every
+// started day, at most MaxLatePenalty percent.
+type GradebookSettings struct {
+	CourseID          uint `gorm:"primary_key;auto_increment:false"`
+	LatePenaltyPerDay float64
+	MaxLatePenalty    float64
+	LetterScale       LetterScale
+}
+
+func (GradebookSettings) TableName() string {
+	return "gradebook_settings"
+}
+
+// GradeOverride replaces the computed score of one item for one student.
+// CSV imports are stored this way.
+type GradeOverride struct {
+	ID        uint `gorm:"primary_key"`
+	UpdatedAt time.Time
+	CourseID  uint
+	UserID    uint
+	ItemKey   string
+	Points    float64
+}
+
+// GradeItem is a column of the gradebook.
+type GradeItem struct {
+	Key        string     `json:"key"`
+	Type       string     `json:"type"`
+	ID         uint       `json:"id"`
+	Title      string     `json:"title"`
+	CategoryID *uint      `json:"category_id"`
+	MaxPoints  float64    `json:"max_points"`
+	DueAt      *time.Time `json:"due_at,omitempty"`
+}
+
+func GradeItemKey(itemType string, id uint) string {
+	return fmt.Sprintf("%s:%d", itemType, id)
+}
+
+// GradeEntry is the score of one student for one item. Points is nil while
+// the item has not been graded; such items do not count yet.
+type GradeEntry struct {
+	Points      *float64 `json:"points"`
+	RawPoints   *float64 `json:"raw_points,omitempty"`
+	Late        bool     `json:"late,omitempty"`
+	Penalty     float64  `json:"penalty_percent,omitempty"`
+	Overridden  bool     `json:"overridden,omitempty"`
+	Dropped     bool     `json:"dropped,omitempty"`
+	submittedAt *time.Time
+}
+
+type StudentGrades struct {
+	UserID           uint                   `json:"user_id"`
+	Email            string                 `json:"email"`
+	Entries          map[string]*GradeEntry `json:"entries"`
+	CategoryPercents map[uint]float64       `json:"category_percents,omitempty"`
+	Percent          *float64               `json:"percent"`
+	Letter           string                 `json:"letter,omitempty"`
+}
+
+type Gradebook struct {
+	CourseID   uint              `json:"course_id"`
+	Settings   GradebookSettings `json:"settings"`
+	Categories []GradeCategory   `json:"categories"`
+	Items      []GradeItem       `json:"items"`
+	Students   []*StudentGrades  `json:"students"`
+	byUser     map[uint]*StudentGrades
+}
+
+type GradebookModel struct {
+	DB *gorm.DB
+}
+
+func (m GradebookModel) GetSettings(courseID uint) (*GradebookSettings, error) {
+	settings := GradebookSettings{CourseID: courseID, MaxLatePenalty: 100, LetterScale: DefaultLetterScale}
+	err := m.DB.Where("course_id = ?", courseID).First(&settings).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+	if len(settings.LetterScale) == 0 {
+		settings.LetterScale = DefaultLetterScale
+	}
+	return &settings, nil
+}
+
+func (m GradebookModel) GetCategories(courseID uint) ([]GradeCategory, error) {
+	var categories []GradeCategory
+	if err := m.DB.Where("course_id = ?", courseID).Order("id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// SaveSettings stores the settings and replaces the categories. Categories
+// that keep their id keep their items; items of removed categories become
+// uncategorized.
+func (m GradebookModel) SaveSettings(settings *GradebookSettings, categories []GradeCategory) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(settings).Error; err != nil {
+			return err
+		}
+
+		var keep []uint
+		for _, category := range categories {
+			if category.ID != 0 {
+				keep = append(keep, category.ID)
+			}
+		}
+		query := tx.Where("course_id = ?", settings.CourseID)
+		if len(keep) > 0 {
+			query = query.Where("id NOT IN (?)", keep)
+		}
+		if err := query.Delete(&GradeCategory{}).Error; err != nil {
+			return err
+		}
+
+		for i := range categories {
+			categories[i].CourseID = settings.CourseID
+			if categories[i].ID != 0 {
+				result := tx.Model(&GradeCategory{}).Where("id = ? AND course_id = ?", categories[i].ID, settings.CourseID).
+					Updates(map[string]interface{}{
+						"name":        categories[i].Name,
+						"weight":      categories[i].Weight,
+						"drop_lowest": categories[i].DropLowest,
+					})
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected == 0 {
+					return fmt.Errorf("category %d does not belong to the course", categories[i].ID)
+				}
+				continue
+			}
+			if err := tx.Create(&categories[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CategoryInCourse reports whether the category belongs to the course.
+func (m GradebookModel) CategoryInCourse(categoryID, courseID uint) (bool, error) {
+	var count int
+	err := m.DB.Model(&GradeCategory{}).Where("id = ? AND course_id = ?", categoryID, courseID).Count(&count).Error
+	return count > 0, err
+}
+
+func (m GradebookModel) SaveOverrides(courseID uint, overrides []GradeOverride) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		for _, o := range overrides {
+			err := tx.Exec(`INSERT INTO grade_overrides (course_id, user_id, item_key, points, updated_at)
+				VALUES (?, ?, ?, ?, NOW())
+				ON CONFLICT (course_id, user_id, item_key) DO UPDATE
+				SET points = EXCLUDED.points, updated_at = NOW()`, courseID, o.UserID, o.ItemKey, o.Points).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// items returns the quizzes and assignments of the course in course order,
+// leaving out those of lessons and modules in the trash.
+func (m GradebookModel) items(courseID uint) ([]GradeItem, error) {
+	var quizzes []struct {
+		ID         uint
+		Title      string
+		CategoryID *uint
+		MaxPoints  float64
+	}
+	err := m.DB.Raw(`SELECT quizzes.id, quizzes.title, quizzes.category_id,
+			COALESCE((SELECT SUM(points) FROM quiz_questions WHERE quiz_questions.quiz_id = quizzes.id), 0) AS max_points
+		FROM quizzes
+		LEFT JOIN lessons ON lessons.id = quizzes.lesson_id
+		JOIN modules ON modules.id = COALESCE(quizzes.module_id, lessons.module_id)
+		WHERE modules.course_id = ? AND quizzes.deleted_at IS NULL
+			AND lessons.deleted_at IS NULL AND modules.deleted_at IS NULL
+		ORDER BY modules.id, quizzes.id`, courseID).Scan(&quizzes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var assignments []Assignment
+	err = m.DB.Joins("JOIN modules ON modules.id = assignments.module_id").
+		Where("modules.course_id = ? AND modules.deleted_at IS NULL", courseID).
+		Order("assignments.due_at, assignments.id").
+		Find(&assignments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]GradeItem, 0, len(quizzes)+len(assignments))
+	for _, q := range quizzes {
+		items = append(items, GradeItem{Key: GradeItemKey(GradeItemQuiz, q.ID), Type: GradeItemQuiz, ID: q.ID, Title: q.Title, CategoryID: q.CategoryID, MaxPoints: q.MaxPoints})
+	}
+	for _, a := range assignments {
+		items = append(items, GradeItem{Key: GradeItemKey(GradeItemAssignment, a.ID), Type: GradeItemAssignment, ID: a.ID, Title: a.Title, CategoryID: a.CategoryID, MaxPoints: a.MaxPoints, DueAt: a.DueAt})
+	}
+	return items, nil
+}
+
+// Get builds the gradebook of the course. With userID set only that
+// student's row is calculated.
+func (m GradebookModel) Get(courseID uint, userID uint) (*Gradebook, error) {
+	settings, err := m.GetSettings(courseID)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := m.GetCategories(courseID)
+	if err != nil {
+		return nil, err
+	}
+	items, err := m.items(courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	gradebook := &Gradebook{
+		CourseID:   courseID,
+		Settings:   *settings,
+		Categories: categories,
+		Items:      items,
+		Students:   []*StudentGrades{},
+		byUser:     make(map[uint]*StudentGrades),
+	}
+
+	enrollmentsQuery := m.DB.Where("course_id = ?", courseID).Order("email")
+	if userID != 0 {
+		enrollmentsQuery = enrollmentsQuery.Where("user_id = ?", userID)
+	}
+	var enrollments []Enrollment
+	if err := enrollmentsQuery.Find(&enrollments).Error; err != nil {
+		return nil, err
+	}
+	for _, e := range enrollments {
+		student := &StudentGrades{UserID: e.UserID, Email: e.Email, Entries: make(map[string]*GradeEntry)}
+		for _, item := range items {
+			student.Entries[item.Key] = &GradeEntry{}
+		}
+		gradebook.Students = append(gradebook.Students, student)
+		gradebook.byUser[e.UserID] = student
+	}
+
+	if err := m.loadScores(gradebook, userID); err != nil {
+		return nil, err
+	}
+	gradebook.calculate()
+	return gradebook, nil
+}
+
+func (m GradebookModel) loadScores(gradebook *Gradebook, userID uint) error {
+	var quizIDs, assignmentIDs []uint
+	for _, item := range gradebook.Items {
+		if item.Type == GradeItemQuiz {
+			quizIDs = append(quizIDs, item.ID)
+		} else {
+			assignmentIDs = append(assignmentIDs, item.ID)
+		}
+	}
+
+	// The best submitted attempt counts.
+	if len(quizIDs) > 0 {
+		var best []struct {
+			QuizID uint
+			UserID uint
+			Score  float64
+		}
+		query := m.DB.Table("quiz_attempts").
+			Select("quiz_id, user_id, MAX(score) AS score").
+			Where("quiz_id IN (?) AND submitted_at IS NOT NULL", quizIDs).
+			Group("quiz_id, user_id")
+		if userID != 0 {
+			query = query.Where("user_id = ?", userID)
+		}
+		if err := query.Scan(&best).Error; err != nil {
+			return err
+		}
+		for _, b := range best {
+			if entry := gradebook.entry(b.UserID, GradeItemKey(GradeItemQuiz, b.QuizID)); entry != nil {
+				score := b.Score
+				entry.RawPoints = &score
+			}
+		}
+	}
+
+	if len(assignmentIDs) > 0 {
+		var submissions []Submission
+		query := m.DB.Where("assignment_id IN (?) AND grade IS NOT NULL", assignmentIDs)
+		if userID != 0 {
+			query = query.Where("user_id = ?", userID)
+		}
+		if err := query.Find(&submissions).Error; err != nil {
+			return err
+		}
+		for _, s := range submissions {
+			if entry := gradebook.entry(s.UserID, GradeItemKey(GradeItemAssignment, s.AssignmentID)); entry != nil {
+				entry.RawPoints = s.Grade
+				entry.Late = s.Late
+				submittedAt := s.SubmittedAt
+				entry.submittedAt = &submittedAt
+			}
+		}
+	}
+
+	var overrides []GradeOverride
+	query := m.DB.Where("course_id = ?", gradebook.CourseID)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if err := query.Find(&overrides).Error; err != nil {
+		return err
+	}
+	for _, o := range overrides {
+		if entry := gradebook.entry(o.UserID, o.ItemKey); entry != nil {
+			points := o.Points
+			entry.Points = &points
+			entry.Overridden = true
+		}
+	}
+	return nil
+}
+
+func (g *Gradebook) entry(userID uint, key string) *GradeEntry {
+	student, ok := g.byUser[userID]
+	if !ok {
+		return nil
+	}
+	return student.Entries[key]
+}
+
+// latePenalty returns the percentage taken off a submission that came in
+// late, one step for every started day after the due date.
+func (s GradebookSettings) latePenalty(dueAt *time.Time, submittedAt *time.Time) float64 {
+	if dueAt == nil || submittedAt == nil || !submittedAt.After(*dueAt) || s.LatePenaltyPerDay <= 0 {
+		return 0
+	}
+	days := math.Ceil(submittedAt.Sub(*dueAt).Hours() / 24)
+	return math.Min(days*s.LatePenaltyPerDay, s.MaxLatePenalty)
+}
+
+// calculate applies late penalties, drops the lowest scores and computes the
+// final percentages and letters.
+func (g *Gradebook) calculate() {
+	for _, student := range g.Students {
+		for _, item := range g.Items {
+			entry := student.Entries[item.Key]
+			if entry.Overridden || entry.RawPoints == nil {
+				continue
+			}
+			points := *entry.RawPoints
+			if entry.Late {
+				entry.Penalty = g.Settings.latePenalty(item.DueAt, entry.submittedAt)
+				points = points * (100 - entry.Penalty) / 100
+			}
+			entry.Points = &points
+		}
+
+		if len(g.Categories) == 0 {
+			student.Percent = g.percentOf(student, g.Items)
+		} else {
+			student.CategoryPercents = make(map[uint]float64)
+			var weighted, weights float64
+			for _, category := range g.Categories {
+				var items []GradeItem
+				for _, item := range g.Items {
+					if item.CategoryID != nil && *item.CategoryID == category.ID {
+						items = append(items, item)
+					}
+				}
+				g.dropLowest(student, items, category.DropLowest)
+				percent := g.percentOf(student, items)
+				if percent == nil {
+					continue
+				}
+				student.CategoryPercents[category.ID] = *percent
+				weighted += *percent * category.Weight
+				weights += category.Weight
+			}
+			if weights > 0 {
+				percent := weighted / weights
+				student.Percent = &percent
+			}
+		}
+
+		if student.Percent != nil {
+			student.Letter = g.Settings.LetterScale.Letter(*student.Percent)
+		}
+	}
+}
+
+// dropLowest marks the n lowest graded items of the student as dropped. At
+// least one graded item is always kept.
+func (g *Gradebook) dropLowest(student *StudentGrades, items []GradeItem, n int) {
+	var graded []GradeItem
+	for _, item := range items {
+		if student.Entries[item.Key].Points != nil && item.MaxPoints > 0 {
+			graded = append(graded, item)
+		}
+	}
+	if n > len(graded)-1 {
+		n = len(graded) - 1
+	}
+	if n <= 0 {
+		return
+	}
+
+	sort.SliceStable(graded, func(i, j int) bool {
+		return *student.Entries[graded[i].Key].Points/graded[i].MaxPoints < *student.Entries[graded[j].Key].Points/graded[j].MaxPoints
+	})
+	for _, item := range graded[:n] {
+		student.Entries[item.Key].Dropped = true
+	}
+}
+
+// percentOf returns the points of the student as a percentage of the
+// possible points, counting only graded items that were not dropped.
+func (g *Gradebook) percentOf(student *StudentGrades, items []GradeItem) *float64 {
+	var earned, possible float64
+	for _, item := range items {
+		entry := student.Entries[item.Key]
+		if entry.Points == nil || entry.Dropped {
+			continue
+		}
+		earned += *entry.Points
+		possible += item.MaxPoints
+	}
+	if possible == 0 {
+		return nil
+	}
+	percent := earned * 100 / possible
+	return &percent
+}
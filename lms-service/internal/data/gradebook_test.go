@@ -0,0 +1,213 @@
+package data
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestLatePenalty(t *testing.T) {
+	due := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := due.Add(d)
+		return &t
+	}
+	settings := GradebookSettings{LatePenaltyPerDay: 10, MaxLatePenalty: 30}
+
+	tests := []struct {
+		name        string
+		settings    GradebookSettings
+		dueAt       *time.Time
+		submittedAt *time.Time
+		want        float64
+	}{
+		{"no due date", settings, nil, at(time.Hour), 0},
+		{"not submitted", settings, &due, nil, 0},
+		{"on time", settings, &due, at(-time.Hour), 0},
+		{"exactly at the due date", settings, &due, at(0), 0},
+		{"one minute late", settings, &due, at(time.Minute), 10},
+		{"exactly one day late", settings, &due, at(24 * time.Hour), 10},
+		{"second day started", settings, &due, at(25 * time.Hour), 20},
+		{"capped", settings, &due, at(10 * 24 * time.Hour), 30},
+		{"no penalty configured", GradebookSettings{MaxLatePenalty: 30}, &due, at(48 * time.Hour), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.settings.latePenalty(tt.dueAt, tt.submittedAt); got != tt.want {
+				t.Errorf("latePenalty() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDropLowest(t *testing.T) {
+	items := []GradeItem{
+		{Key: "a", MaxPoints: 10},
+		{Key: "b", MaxPoints: 20},
+		{Key: "c", MaxPoints: 10},
+		{Key: "d", MaxPoints: 10},
+	}
+
+	tests := []struct {
+		name    string
+		points  map[string]*float64
+		n       int
+		dropped []string
+	}{
+		{"nothing to drop", map[string]*float64{"a": float(5), "b": float(5), "c": float(5), "d": float(5)}, 0, nil},
+		// b has the most points but the lowest percentage.
+		{"lowest percentage", map[string]*float64{"a": float(6), "b": float(8), "c": float(9), "d": float(10)}, 1, []string{"b"}},
+		{"two lowest", map[string]*float64{"a": float(6), "b": float(8), "c": float(9), "d": float(10)}, 2, []string{"a", "b"}},
+		{"ungraded items are not dropped", map[string]*float64{"a": nil, "b": float(20), "c": float(3), "d": nil}, 1, []string{"c"}},
+		{"keeps one graded item", map[string]*float64{"a": float(1), "b": float(2), "c": nil, "d": nil}, 5, []string{"a"}},
+		{"single graded item", map[string]*float64{"a": float(1), "b": nil, "c": nil, "d": nil}, 1, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			student := &StudentGrades{Entries: make(map[string]*GradeEntry)}
+			for key, points := range tt.points {
+				student.Entries[key] = &GradeEntry{Points: points}
+			}
+
+			(&Gradebook{}).dropLowest(student, items, tt.n)
+
+			want := make(map[string]bool)
+			for _, key := range tt.dropped {
+				want[key] = true
+			}
+			for key, entry := range student.Entries {
+				if entry.Dropped != want[key] {
+					t.Errorf("item %s dropped = %v, want %v", key, entry.Dropped, want[key])
+				}
+			}
+		})
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	due := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	late := due.Add(36 * time.Hour)
+	homework, exams := uint(1), uint(2)
+
+	tests := []struct {
+		name       string
+		settings   GradebookSettings
+		categories []GradeCategory
+		items      []GradeItem
+		entries    map[string]*GradeEntry
+		percent    *float64
+		letter     string
+		points     map[string]float64
+	}{
+		{
+			name:     "nothing graded",
+			settings: GradebookSettings{LetterScale: DefaultLetterScale},
+			items:    []GradeItem{{Key: "a", MaxPoints: 10}},
+			entries:  map[string]*GradeEntry{"a": {}},
+		},
+		{
+			name:     "points of all items",
+			settings: GradebookSettings{LetterScale: DefaultLetterScale},
+			items:    []GradeItem{{Key: "a", MaxPoints: 10}, {Key: "b", MaxPoints: 30}, {Key: "c", MaxPoints: 10}},
+			entries: map[string]*GradeEntry{
+				"a": {RawPoints: float(10)},
+				"b": {RawPoints: float(24)},
+				"c": {},
+			},
+			percent: float(85),
+			letter:  "B",
+			points:  map[string]float64{"a": 10, "b": 24},
+		},
+		{
+			name:     "late penalty",
+			settings: GradebookSettings{LatePenaltyPerDay: 10, MaxLatePenalty: 50, LetterScale: DefaultLetterScale},
+			items:    []GradeItem{{Key: "a", MaxPoints: 10, DueAt: &due}},
+			entries: map[string]*GradeEntry{
+				"a": {RawPoints: float(10), Late: true, submittedAt: &late},
+			},
+			percent: float(80),
+			letter:  "B",
+			points:  map[string]float64{"a": 8},
+		},
+		{
+			name:     "overrides are kept",
+			settings: GradebookSettings{LatePenaltyPerDay: 10, MaxLatePenalty: 50},
+			items:    []GradeItem{{Key: "a", MaxPoints: 10, DueAt: &due}},
+			entries: map[string]*GradeEntry{
+				"a": {Points: float(7), RawPoints: float(10), Late: true, Overridden: true, submittedAt: &late},
+			},
+			percent: float(70),
+			points:  map[string]float64{"a": 7},
+		},
+		{
+			name:       "weighted categories",
+			settings:   GradebookSettings{LetterScale: DefaultLetterScale},
+			categories: []GradeCategory{{ID: homework, Weight: 1, DropLowest: 1}, {ID: exams, Weight: 3}},
+			items: []GradeItem{
+				{Key: "h1", CategoryID: &homework, MaxPoints: 10},
+				{Key: "h2", CategoryID: &homework, MaxPoints: 10},
+				{Key: "e1", CategoryID: &exams, MaxPoints: 100},
+				{Key: "x", MaxPoints: 100},
+			},
+			entries: map[string]*GradeEntry{
+				"h1": {RawPoints: float(2)},
+				"h2": {RawPoints: float(10)},
+				"e1": {RawPoints: float(60)},
+				"x":  {RawPoints: float(0)},
+			},
+			// (100 * 1 + 60 * 3) / 4; uncategorised items do not count.
+			percent: float(70),
+			letter:  "C",
+			points:  map[string]float64{"h1": 2, "h2": 10, "e1": 60, "x": 0},
+		},
+		{
+			name:       "categories without grades are skipped",
+			categories: []GradeCategory{{ID: homework, Weight: 1}, {ID: exams, Weight: 3}},
+			items:      []GradeItem{{Key: "h1", CategoryID: &homework, MaxPoints: 10}, {Key: "e1", CategoryID: &exams, MaxPoints: 100}},
+			entries: map[string]*GradeEntry{
+				"h1": {RawPoints: float(5)},
+				"e1": {},
+			},
+			percent: float(50),
+			points:  map[string]float64{"h1": 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			student := &StudentGrades{Entries: tt.entries}
+			g := &Gradebook{Settings: tt.settings, Categories: tt.categories, Items: tt.items, Students: []*StudentGrades{student}}
+
+			g.calculate()
+
+			switch {
+			case tt.percent == nil && student.Percent != nil:
+				t.Errorf("percent = %v, want none", *student.Percent)
+			case tt.percent != nil && student.Percent == nil:
+				t.Errorf("percent = none, want %v", *tt.percent)
+			case tt.percent != nil && math.Abs(*student.Percent-*tt.percent) > 1e-9:
+				t.Errorf("percent = %v, want %v", *student.Percent, *tt.percent)
+			}
+			if student.Letter != tt.letter {
+				t.Errorf("letter = %q, want %q", student.Letter, tt.letter)
+			}
+			for key, entry := range student.Entries {
+				want, graded := tt.points[key]
+				switch {
+				case !graded && entry.Points != nil:
+					t.Errorf("item %s has %v points, want none", key, *entry.Points)
+				case graded && entry.Points == nil:
+					t.Errorf("item %s has no points, want %v", key, want)
+				case graded && math.Abs(*entry.Points-want) > 1e-9:
+					t.Errorf("item %s has %v points, want %v", key, *entry.Points, want)
+				}
+			}
+		})
+	}
+}
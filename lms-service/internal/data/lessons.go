@@ -10,14 +10,40 @@ type Lesson struct {
 	Link     string
 	Conspect string
 	ModuleID uint
+	Position int
+	// Progress is the state of the lesson for the calling user.
+	Progress string `gorm:"-" json:",omitempty"`
+	// PrerequisiteIDs, Locked and LockReason are filled in by
+	// PrerequisiteModel.ApplyToCourse.
+	PrerequisiteIDs []uint `gorm:"-" json:",omitempty"`
+	Locked          bool   `gorm:"-" json:",omitempty"`
+	LockReason      string `gorm:"-" json:",omitempty"`
+}
+
+// HideContent clears everything but the outline of a lesson the caller may
+// not open.
+func (l *Lesson) HideContent() {
+	l.Link = ""
+	l.Conspect = ""
 }
 
 type LessonModel struct {
 	DB *gorm.DB
 }
 
-func (m LessonModel) Insert(lesson *Lesson) error {
-	return m.DB.Create(lesson).Error
+// Insert adds the lesson after the last lesson of its module.
+func (m LessonModel) Insert(lesson *Lesson, meta RevisionMeta) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		position, err := nextPosition(tx, "lessons", "module_id", lesson.ModuleID)
+		if err != nil {
+			return err
+		}
+		lesson.Position = position
+		if err := tx.Create(lesson).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, lesson, meta)
+	})
 }
 
 func (m LessonModel) Get(id uint) (*Lesson, error) {
@@ -29,14 +55,120 @@ func (m LessonModel) Get(id uint) (*Lesson, error) {
 	return &lesson, nil
 }
 
-func (m LessonModel) Update(lesson *Lesson) error {
-	return m.DB.Save(lesson).Error
+// Update saves the lesson and records the edit as a revision. The position
+// and the module are left alone, they only change through Reorder and Move.
+func (m LessonModel) Update(lesson *Lesson, meta RevisionMeta) error {
+	return saveWithRevision(m.DB, lesson, meta)
+}
+
+// lessonIDsForUpdate locks the lessons of a module and returns their ids in
+// order.
+func lessonIDsForUpdate(tx *gorm.DB, moduleID uint) ([]uint, error) {
+	var lessons []Lesson
+	err := orderLessons(tx.Set("gorm:query_option", "FOR UPDATE")).Select("id").Where("module_id = ?", moduleID).Find(&lessons).Error
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(lessons))
+	for i, lesson := range lessons {
+		ids[i] = lesson.ID
+	}
+	return ids, nil
+}
+
+// checkModuleCycles runs checkPrerequisiteCycles on the course of the module.
+func checkModuleCycles(tx *gorm.DB, moduleID uint) error {
+	var module Module
+	if err := tx.Select("course_id").First(&module, moduleID).Error; err != nil {
+		return err
+	}
+	return checkPrerequisiteCycles(tx, module.CourseID)
+}
+
+// Reorder puts the lessons of a module in the order of ids, which must list
+// every lesson of the module exactly once. In a sequential course the new
+// order may not make a lesson wait for itself.
+func (m LessonModel) Reorder(moduleID uint, ids []uint) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		current, err := lessonIDsForUpdate(tx, moduleID)
+		if err != nil {
+			return err
+		}
+		if !sameIDs(current, ids) {
+			return ErrInvalidOrder
+		}
+		if err := renumber(tx, &Lesson{}, ids); err != nil {
+			return err
+		}
+		return checkModuleCycles(tx, moduleID)
+	})
+}
+
+// Move puts the lesson into moduleID at position, or at the end when
+// position is nil, and closes the gap it leaves in its old module. The move
+// fails with ErrPrerequisiteCycle when the lesson would end up waiting for
+// itself.
+func (m LessonModel) Move(lesson *Lesson, moduleID uint, position *int) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if lesson.ModuleID != moduleID {
+			source, err := lessonIDsForUpdate(tx, lesson.ModuleID)
+			if err != nil {
+				return err
+			}
+			if err := renumber(tx, &Lesson{}, removeID(source, lesson.ID)); err != nil {
+				return err
+			}
+		}
+
+		target, err := lessonIDsForUpdate(tx, moduleID)
+		if err != nil {
+			return err
+		}
+		target = removeID(target, lesson.ID)
+		at := len(target)
+		if position != nil && *position >= 0 && *position < at {
+			at = *position
+		}
+		target = append(target[:at], append([]uint{lesson.ID}, target[at:]...)...)
+
+		if err := tx.Model(&Lesson{}).Where("id = ?", lesson.ID).UpdateColumn("module_id", moduleID).Error; err != nil {
+			return err
+		}
+		if err := renumber(tx, &Lesson{}, target); err != nil {
+			return err
+		}
+		if err := checkModuleCycles(tx, moduleID); err != nil {
+			return err
+		}
+		lesson.ModuleID = moduleID
+		lesson.Position = at
+		return nil
+	})
+}
+
+func removeID(ids []uint, id uint) []uint {
+	kept := ids[:0]
+	for _, other := range ids {
+		if other != id {
+			kept = append(kept, other)
+		}
+	}
+	return kept
 }
 
 func (m LessonModel) Delete(id uint) error {
 	return m.DB.Delete(&Lesson{}, id).Error
 }
 
+// GetCourseID returns the id of the course the lesson belongs to.
+func (m LessonModel) GetCourseID(lesson *Lesson) (uint, error) {
+	var module Module
+	if err := m.DB.Select("course_id").First(&module, lesson.ModuleID).Error; err != nil {
+		return 0, err
+	}
+	return module.CourseID, nil
+}
+
 func (m LessonModel) GetModuleName(moduleID int) string {
 	var moduleName string
 	result := m.DB.Table("modules").Select("title").Where("id = ?", moduleID).First(&moduleName)
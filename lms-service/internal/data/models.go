@@ -1,67 +1,118 @@
 package data
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 	"github.com/rs/zerolog"
 	"github.com/streadway/amqp"
 	"lms-crud-api/middleware"
+	"lms-shared/events"
+	"lms-shared/query"
+	"lms-shared/query/gormv1"
 )
 
-type Notification struct {
-	MessageTo string `json:"messageTo"`
-	Content   string `json:"content"`
-}
-
 type Models struct {
-	Courses  CourseModel
-	Modules  ModuleModel
-	Lessons  LessonModel
-	UserInfo UserModel
+	Courses       CourseModel
+	Modules       ModuleModel
+	Lessons       LessonModel
+	Collaborators CollaboratorModel
+	Enrollments   EnrollmentModel
+	Progress      ProgressModel
+	Quizzes       QuizModel
+	Assignments   AssignmentModel
+	Gradebook     GradebookModel
+	Prerequisites PrerequisiteModel
+	Revisions     RevisionModel
+	Trash         TrashModel
+	Search        SearchModel
+	UserInfo      UserModel
 }
 
 func NewModels(db *gorm.DB) Models {
 	return Models{
-		Courses:  CourseModel{DB: db},
-		Modules:  ModuleModel{DB: db},
-		Lessons:  LessonModel{DB: db},
-		UserInfo: UserModel{DB: db},
+		Courses:       CourseModel{DB: db},
+		Modules:       ModuleModel{DB: db},
+		Lessons:       LessonModel{DB: db},
+		Collaborators: CollaboratorModel{DB: db},
+		Enrollments:   EnrollmentModel{DB: db},
+		Progress:      ProgressModel{DB: db},
+		Quizzes:       QuizModel{DB: db},
+		Assignments:   AssignmentModel{DB: db},
+		Gradebook:     GradebookModel{DB: db},
+		Prerequisites: PrerequisiteModel{DB: db},
+		Revisions:     RevisionModel{DB: db},
+		Trash:         TrashModel{DB: db},
+		Search:        SearchModel{DB: db},
+		UserInfo:      UserModel{DB: db},
 	}
 }
 
 func (m ModuleModel) GetWithLessons(id uint) (*Module, error) {
 	var module Module
-	if err := m.DB.Preload("Lessons").First(&module, id).Error; err != nil {
+	if err := m.DB.Preload("Lessons", orderLessons).First(&module, id).Error; err != nil {
 		return nil, err
 	}
 	return &module, nil
 }
 
-func (m CourseModel) GetWithModulesAndLessons(id uint) (*Course, error) {
+// GetWithModulesAndLessons loads the course with its content and the
+// prerequisites. When userID is not zero the progress of that user and the
+// content still locked for them are filled in as well.
+func (m CourseModel) GetWithModulesAndLessons(id uint, userID uint) (*Course, error) {
 	var course Course
 	if err := m.DB.Preload("Modules", func(db *gorm.DB) *gorm.DB {
-		return db.Preload("Lessons")
+		return orderModules(db).Preload("Lessons", orderLessons)
 	}).First(&course, id).Error; err != nil {
 		return nil, err
 	}
+	if userID != 0 {
+		if err := (ProgressModel{DB: m.DB}).ApplyToCourse(&course, userID); err != nil {
+			return nil, err
+		}
+	}
+	if err := (PrerequisiteModel{DB: m.DB}).ApplyToCourse(&course, userID != 0); err != nil {
+		return nil, err
+	}
 	return &course, nil
 }
 
-func (m CourseModel) GetAllWithModulesAndLessons() ([]Course, error) {
+// CourseListSpec declares the sorting and filters of course lists.
+var CourseListSpec = query.Spec{
+	Sort: map[string]query.SortField{
+		"id":         {Column: "courses.id", Field: "ID"},
+		"title":      {Column: "courses.title", Field: "Title"},
+		"created_at": {Column: "courses.created_at", Field: "CreatedAt"},
+		"updated_at": {Column: "courses.updated_at", Field: "UpdatedAt"},
+	},
+	DefaultSort: "-created_at",
+	Filters: map[string]query.Filter{
+		"title":          query.Contains("courses.title"),
+		"status":         query.Equals("courses.status"),
+		"owner_id":       query.Equals("courses.owner_id"),
+		"created_after":  query.After("courses.created_at"),
+		"created_before": query.Before("courses.created_at"),
+	},
+	IDColumn: "courses.id",
+}
+
+// GetAllWithModulesAndLessons returns one page of the courses the viewer may
+// see, with their content.
+func (m CourseModel) GetAllWithModulesAndLessons(viewer CourseViewer, q *query.Query) ([]Course, query.Metadata, error) {
 	var courses []Course
-	if err := m.DB.Preload("Modules", func(db *gorm.DB) *gorm.DB {
-		return db.Preload("Lessons")
-	}).Find(&courses).Error; err != nil {
-		return nil, err
+	db := viewer.scope(m.DB).Preload("Modules", func(db *gorm.DB) *gorm.DB {
+		return orderModules(db).Preload("Lessons", orderLessons)
+	})
+	metadata, err := gormv1.Find(db, q, &courses)
+	if err != nil {
+		return nil, query.Metadata{}, err
 	}
-	return courses, nil
+	return courses, metadata, nil
 }
 
 func (m ModuleModel) GetAllWithLessonsForCourse(courseID uint) ([]Module, error) {
 	var modules []Module
-	if err := m.DB.Preload("Lessons").Where("course_id = ?", courseID).Find(&modules).Error; err != nil {
+	if err := orderModules(m.DB.Preload("Lessons", orderLessons)).Where("course_id = ?", courseID).Find(&modules).Error; err != nil {
 		return nil, err
 	}
 	return modules, nil
@@ -69,25 +120,45 @@ func (m ModuleModel) GetAllWithLessonsForCourse(courseID uint) ([]Module, error)
 
 func (l LessonModel) GetAllForModule(moduleID uint) ([]Lesson, error) {
 	var lessons []Lesson
-	if err := l.DB.Where("module_id = ?", moduleID).Find(&lessons).Error; err != nil {
+	if err := orderLessons(l.DB).Where("module_id = ?", moduleID).Find(&lessons).Error; err != nil {
 		return nil, err
 	}
 	return lessons, nil
 }
 
-func (m ModuleModel) GetAll() ([]Module, error) {
+// ModuleListSpec declares the sorting and filters of module lists.
+var ModuleListSpec = query.Spec{
+	Sort: map[string]query.SortField{
+		"id":         {Column: "id", Field: "ID"},
+		"title":      {Column: "title", Field: "Title"},
+		"course_id":  {Column: "course_id", Field: "CourseID"},
+		"position":   {Column: "position", Field: "Position"},
+		"created_at": {Column: "created_at", Field: "CreatedAt"},
+	},
+	DefaultSort: "course_id,position",
+	Filters: map[string]query.Filter{
+		"title":          query.Contains("title"),
+		"course_id":      query.Equals("course_id"),
+		"created_after":  query.After("created_at"),
+		"created_before": query.Before("created_at"),
+	},
+}
+
+// GetAll returns one page of the modules of the courses the viewer may see.
+func (m ModuleModel) GetAll(viewer CourseViewer, q *query.Query) ([]Module, query.Metadata, error) {
 	var modules []Module
-	if err := m.DB.Find(&modules).Error; err != nil {
-		return nil, err
+	courses := viewer.scope(m.DB.Table("courses").Select("courses.id")).SubQuery()
+	metadata, err := gormv1.Find(m.DB.Where("course_id IN ?", courses), q, &modules)
+	if err != nil {
+		return nil, query.Metadata{}, err
 	}
-	return modules, nil
+	return modules, metadata, nil
 }
 
 func GetUserEmail(c *gin.Context, logger zerolog.Logger) string {
-	claims, _ := c.Get("claims")
-	userClaims := claims.(*middleware.Claims)
+	userClaims := middleware.ClaimsFromContext(c)
 
-	logger.Info().Msgf("User email: %d", userClaims.Email)
+	logger.Info().Msgf("User email: %s", userClaims.Email)
 
 	return userClaims.Email
 }
@@ -109,7 +180,7 @@ func ConnectToRabbitMQ() (*amqp.Channel, error) {
 func DeclareQueue(ch *amqp.Channel, queueName string) error {
 	_, err := ch.QueueDeclare(
 		"notification_queue", // Name of the queue
-		false,
+		true,
 		false,
 		false,
 		false,
@@ -128,8 +199,9 @@ func PublishMessage(ch *amqp.Channel, queueName string, message string) error {
 		false,                // Mandatory flag (optional, can be set to true for guaranteed delivery)
 		false,                // Immediate flag (optional, can be set to true to skip the publisher confirmation)
 		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        []byte(message),
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Body:         []byte(message),
 		},
 	)
 	if err != nil {
@@ -139,34 +211,38 @@ func PublishMessage(ch *amqp.Channel, queueName string, message string) error {
 	return nil
 }
 
-func (m CourseModel) SendMessageToQueue(l zerolog.Logger, ch *amqp.Channel, c *gin.Context, content string) {
+// PublishEvent tells the current user about event in the language of their
+// token.
+func (m CourseModel) PublishEvent(l zerolog.Logger, ch *amqp.Channel, c *gin.Context, event events.Event) error {
 	// Get the current user's email from the context
 	email := GetUserEmail(c, l)
 
-	// Create the notification message
-	notification := Notification{
-		MessageTo: email,
-		Content:   content,
-	}
+	return m.PublishEventToUser(l, ch, email, middleware.ClaimsFromContext(c).Language, event)
+}
 
-	// Convert the notification message to JSON
-	messageJSON, err := json.Marshal(notification)
+// PublishEventToUser notifies someone other than the current user, such as a
+// student whose work was graded. An empty language leaves the choice to the
+// notification service. Failures are logged and returned; the change that
+// caused the event has already been made, so callers usually go on.
+func (m CourseModel) PublishEventToUser(l zerolog.Logger, ch *amqp.Channel, email, language string, event events.Event) error {
+	// Wrap the event in an envelope and convert it to JSON
+	messageJSON, err := events.Marshal(email, language, event)
 	if err != nil {
-		l.Fatal().Err(err).Msg("Failed to marshal message to JSON")
-		return
+		l.Error().Err(err).Msgf("Failed to marshal %s event to JSON", event.Type())
+		return err
 	}
 
 	// Declare the queue
 	err = DeclareQueue(ch, "notification_queue")
 	if err != nil {
-		l.Fatal().Err(err).Msg("Failed to declare a queue")
-		return
+		l.Error().Err(err).Msg("Failed to declare a queue")
+		return err
 	}
-	defer ch.Close()
-
 	// Publish the message
 	err = PublishMessage(ch, "notification_queue", string(messageJSON))
 	if err != nil {
-		l.Fatal().Err(err).Msg("Failed to publish a message")
+		l.Error().Err(err).Msgf("Failed to publish %s event", event.Type())
+		return err
 	}
+	return nil
 }
@@ -1,6 +1,8 @@
 package data
 
 import (
+	"time"
+
 	"github.com/jinzhu/gorm"
 )
 
@@ -8,15 +10,34 @@ type Module struct {
 	gorm.Model
 	Title    string
 	CourseID uint
+	Position int
 	Lessons  []Lesson
+	// CompletionPercent is filled in for the calling user.
+	CompletionPercent *float64 `gorm:"-" json:",omitempty"`
+	// PrerequisiteIDs, Locked and LockReason are filled in by
+	// PrerequisiteModel.ApplyToCourse.
+	PrerequisiteIDs []uint `gorm:"-" json:",omitempty"`
+	Locked          bool   `gorm:"-" json:",omitempty"`
+	LockReason      string `gorm:"-" json:",omitempty"`
 }
 
 type ModuleModel struct {
 	DB *gorm.DB
 }
 
-func (m ModuleModel) Insert(module *Module) error {
-	return m.DB.Create(module).Error
+// Insert adds the module after the last module of its course.
+func (m ModuleModel) Insert(module *Module, meta RevisionMeta) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		position, err := nextPosition(tx, "modules", "course_id", module.CourseID)
+		if err != nil {
+			return err
+		}
+		module.Position = position
+		if err := tx.Create(module).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, module, meta)
+	})
 }
 
 func (m ModuleModel) Get(id uint) (*Module, error) {
@@ -28,10 +49,38 @@ func (m ModuleModel) Get(id uint) (*Module, error) {
 	return &module, nil
 }
 
-func (m ModuleModel) Update(module *Module) error {
-	return m.DB.Save(module).Error
+// Update saves the module and records the edit as a revision. The position
+// is left alone, it only changes through Reorder.
+func (m ModuleModel) Update(module *Module, meta RevisionMeta) error {
+	return saveWithRevision(m.DB, module, meta)
+}
+
+// Reorder puts the modules of a course in the order of ids, which must list
+// every module of the course exactly once. In a sequential course the new
+// order may not make a lesson wait for itself.
+func (m ModuleModel) Reorder(courseID uint, ids []uint) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		var modules []Module
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Select("id").Where("course_id = ?", courseID).Find(&modules).Error; err != nil {
+			return err
+		}
+		current := make([]uint, len(modules))
+		for i, module := range modules {
+			current[i] = module.ID
+		}
+		if !sameIDs(current, ids) {
+			return ErrInvalidOrder
+		}
+		if err := renumber(tx, &Module{}, ids); err != nil {
+			return err
+		}
+		return checkPrerequisiteCycles(tx, courseID)
+	})
 }
 
+// Delete moves the module with its lessons to the trash.
 func (m ModuleModel) Delete(id uint) error {
-	return m.DB.Delete(&Module{}, id).Error
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		return deleteModule(tx, id, time.Now())
+	})
 }
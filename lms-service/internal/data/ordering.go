@@ -0,0 +1,53 @@
+package data
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+)
+
+var ErrInvalidOrder = errors.New("the order must list every item exactly once")
+
+func orderModules(db *gorm.DB) *gorm.DB {
+	return db.Order("modules.position, modules.id")
+}
+
+func orderLessons(db *gorm.DB) *gorm.DB {
+	return db.Order("lessons.position, lessons.id")
+}
+
+// sameIDs reports whether order is a permutation of current.
+func sameIDs(current, order []uint) bool {
+	if len(current) != len(order) {
+		return false
+	}
+	seen := make(map[uint]bool, len(current))
+	for _, id := range current {
+		seen[id] = true
+	}
+	for _, id := range order {
+		if !seen[id] {
+			return false
+		}
+		delete(seen, id)
+	}
+	return true
+}
+
+// renumber stores the index of every id as its position.
+func renumber(tx *gorm.DB, model interface{}, ids []uint) error {
+	for i, id := range ids {
+		if err := tx.Model(model).Where("id = ?", id).UpdateColumn("position", i).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nextPosition returns the position after the last row of table whose
+// column equals parentID.
+func nextPosition(db *gorm.DB, table, column string, parentID uint) (int, error) {
+	var position int
+	err := db.Table(table).Where(column+" = ?", parentID).Select("COALESCE(MAX(position) + 1, 0)").Row().Scan(&position)
+	return position, err
+}
@@ -0,0 +1,389 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	ErrInvalidPrerequisite = errors.New("prerequisites must belong to the same course")
+	ErrPrerequisiteCycle   = errors.New("the prerequisites would depend on each other in a cycle")
+)
+
+// ModulePrerequisite makes a module wait until every lesson of the
+// prerequisite module is completed.
+type ModulePrerequisite struct {
+	ModuleID       uint `gorm:"primary_key;auto_increment:false"`
+	PrerequisiteID uint `gorm:"primary_key;auto_increment:false"`
+}
+
+// LessonPrerequisite makes a lesson wait until the prerequisite lesson is
+// completed.
+type LessonPrerequisite struct {
+	LessonID       uint `gorm:"primary_key;auto_increment:false"`
+	PrerequisiteID uint `gorm:"primary_key;auto_increment:false"`
+}
+
+type PrerequisiteModel struct {
+	DB *gorm.DB
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+const (
+	lessonNode = iota
+	moduleStartNode
+	moduleEndNode
+)
+
+// prerequisiteNode is a vertex of the dependency graph of a course. A
+// module has two of them: its start waits for the prerequisite modules and
+// its end for every lesson of the module.
+type prerequisiteNode struct {
+	kind int
+	id   uint
+}
+
+// prerequisiteGraph points from everything that can be locked to what has to
+// be completed first.
+type prerequisiteGraph map[prerequisiteNode][]prerequisiteNode
+
+func (g prerequisiteGraph) add(from, to prerequisiteNode) {
+	g[from] = append(g[from], to)
+}
+
+// newPrerequisiteGraph links the content of the course, with the modules and
+// lessons in course order. Lessons wait for the start of their module and,
+// in sequential courses, for the lesson before them.
+func newPrerequisiteGraph(course *Course, modulePrerequisites []ModulePrerequisite, lessonPrerequisites []LessonPrerequisite) prerequisiteGraph {
+	g := make(prerequisiteGraph)
+	var previous *prerequisiteNode
+	for _, module := range course.Modules {
+		start := prerequisiteNode{moduleStartNode, module.ID}
+		end := prerequisiteNode{moduleEndNode, module.ID}
+		for _, lesson := range module.Lessons {
+			node := prerequisiteNode{lessonNode, lesson.ID}
+			g.add(node, start)
+			g.add(end, node)
+			if course.Sequential && previous != nil {
+				g.add(node, *previous)
+			}
+			previous = &node
+		}
+	}
+	for _, p := range modulePrerequisites {
+		g.add(prerequisiteNode{moduleStartNode, p.ModuleID}, prerequisiteNode{moduleEndNode, p.PrerequisiteID})
+	}
+	for _, p := range lessonPrerequisites {
+		g.add(prerequisiteNode{lessonNode, p.LessonID}, prerequisiteNode{lessonNode, p.PrerequisiteID})
+	}
+	return g
+}
+
+// loadPrerequisiteGraph builds the graph of the course from the database,
+// leaving out the prerequisites of skip so that they can be replaced.
+func loadPrerequisiteGraph(tx *gorm.DB, courseID uint, skip prerequisiteNode) (prerequisiteGraph, error) {
+	var course Course
+	if err := tx.Preload("Modules", func(db *gorm.DB) *gorm.DB {
+		return orderModules(db).Preload("Lessons", orderLessons)
+	}).First(&course, courseID).Error; err != nil {
+		return nil, err
+	}
+
+	var modulePrerequisites []ModulePrerequisite
+	err := tx.Joins("JOIN modules ON modules.id = module_prerequisites.module_id").
+		Where("modules.course_id = ?", courseID).
+		Find(&modulePrerequisites).Error
+	if err != nil {
+		return nil, err
+	}
+	var lessonPrerequisites []LessonPrerequisite
+	err = tx.Joins("JOIN lessons ON lessons.id = lesson_prerequisites.lesson_id").
+		Joins("JOIN modules ON modules.id = lessons.module_id").
+		Where("modules.course_id = ?", courseID).
+		Find(&lessonPrerequisites).Error
+	if err != nil {
+		return nil, err
+	}
+
+	moduleRows := modulePrerequisites[:0]
+	for _, p := range modulePrerequisites {
+		if skip != (prerequisiteNode{moduleStartNode, p.ModuleID}) {
+			moduleRows = append(moduleRows, p)
+		}
+	}
+	lessonRows := lessonPrerequisites[:0]
+	for _, p := range lessonPrerequisites {
+		if skip != (prerequisiteNode{lessonNode, p.LessonID}) {
+			lessonRows = append(lessonRows, p)
+		}
+	}
+	return newPrerequisiteGraph(&course, moduleRows, lessonRows), nil
+}
+
+// reaches reports whether target can be reached from any of from by
+// following edges.
+func reaches(edges prerequisiteGraph, from []prerequisiteNode, target prerequisiteNode) bool {
+	visited := make(map[prerequisiteNode]bool)
+	stack := append([]prerequisiteNode(nil), from...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == target {
+			return true
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		stack = append(stack, edges[id]...)
+	}
+	return false
+}
+
+// hasCycle reports whether any node of the graph waits for itself.
+func (g prerequisiteGraph) hasCycle() bool {
+	for node, prerequisites := range g {
+		if reaches(g, prerequisites, node) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPrerequisiteCycles fails with ErrPrerequisiteCycle when any content
+// of the course waits for itself. It runs after changes to the lesson order
+// or the sequential flag, which add edges of their own.
+func checkPrerequisiteCycles(tx *gorm.DB, courseID uint) error {
+	// No lesson has id 0, so the zero node leaves nothing out.
+	edges, err := loadPrerequisiteGraph(tx, courseID, prerequisiteNode{})
+	if err != nil {
+		return err
+	}
+	if edges.hasCycle() {
+		return ErrPrerequisiteCycle
+	}
+	return nil
+}
+
+// SetForModule replaces the prerequisites of a module. They must be other
+// modules of the same course, and may not make any content of the course
+// wait for itself through lesson prerequisites or the lesson order of a
+// sequential course.
+func (m PrerequisiteModel) SetForModule(module *Module, prerequisiteIDs []uint) error {
+	prerequisiteIDs = uniqueIDs(prerequisiteIDs)
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if len(prerequisiteIDs) > 0 {
+			var count int
+			if err := tx.Model(&Module{}).Where("id IN (?) AND course_id = ? AND id <> ?", prerequisiteIDs, module.CourseID, module.ID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count != len(prerequisiteIDs) {
+				return ErrInvalidPrerequisite
+			}
+
+			start := prerequisiteNode{moduleStartNode, module.ID}
+			edges, err := loadPrerequisiteGraph(tx, module.CourseID, start)
+			if err != nil {
+				return err
+			}
+			ends := make([]prerequisiteNode, len(prerequisiteIDs))
+			for i, id := range prerequisiteIDs {
+				ends[i] = prerequisiteNode{moduleEndNode, id}
+			}
+			if reaches(edges, ends, start) {
+				return ErrPrerequisiteCycle
+			}
+		}
+
+		if err := tx.Where("module_id = ?", module.ID).Delete(&ModulePrerequisite{}).Error; err != nil {
+			return err
+		}
+		for _, id := range prerequisiteIDs {
+			if err := tx.Create(&ModulePrerequisite{ModuleID: module.ID, PrerequisiteID: id}).Error; err != nil {
+				return err
+			}
+		}
+		module.PrerequisiteIDs = prerequisiteIDs
+		return nil
+	})
+}
+
+// SetForLesson replaces the prerequisites of a lesson. They must be other
+// lessons of the same course, and may not make any content of the course
+// wait for itself through module prerequisites or the lesson order of a
+// sequential course.
+func (m PrerequisiteModel) SetForLesson(lesson *Lesson, courseID uint, prerequisiteIDs []uint) error {
+	prerequisiteIDs = uniqueIDs(prerequisiteIDs)
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		if len(prerequisiteIDs) > 0 {
+			var count int
+			err := tx.Model(&Lesson{}).
+				Joins("JOIN modules ON modules.id = lessons.module_id").
+				Where("lessons.id IN (?) AND modules.course_id = ? AND lessons.id <> ?", prerequisiteIDs, courseID, lesson.ID).
+				Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count != len(prerequisiteIDs) {
+				return ErrInvalidPrerequisite
+			}
+
+			node := prerequisiteNode{lessonNode, lesson.ID}
+			edges, err := loadPrerequisiteGraph(tx, courseID, node)
+			if err != nil {
+				return err
+			}
+			prerequisites := make([]prerequisiteNode, len(prerequisiteIDs))
+			for i, id := range prerequisiteIDs {
+				prerequisites[i] = prerequisiteNode{lessonNode, id}
+			}
+			if reaches(edges, prerequisites, node) {
+				return ErrPrerequisiteCycle
+			}
+		}
+
+		if err := tx.Where("lesson_id = ?", lesson.ID).Delete(&LessonPrerequisite{}).Error; err != nil {
+			return err
+		}
+		for _, id := range prerequisiteIDs {
+			if err := tx.Create(&LessonPrerequisite{LessonID: lesson.ID, PrerequisiteID: id}).Error; err != nil {
+				return err
+			}
+		}
+		lesson.PrerequisiteIDs = prerequisiteIDs
+		return nil
+	})
+}
+
+// ApplyToCourse fills in the prerequisites of the modules and lessons of the
+// course. When withLocks is set it also flags the content the user still
+// has to unlock, which needs the progress filled in by
+// ProgressModel.ApplyToCourse first.
+func (m PrerequisiteModel) ApplyToCourse(course *Course, withLocks bool) error {
+	var moduleIDs, lessonIDs []uint
+	for _, module := range course.Modules {
+		moduleIDs = append(moduleIDs, module.ID)
+		for _, lesson := range module.Lessons {
+			lessonIDs = append(lessonIDs, lesson.ID)
+		}
+	}
+
+	modulePrerequisites := make(map[uint][]uint)
+	if len(moduleIDs) > 0 {
+		var rows []ModulePrerequisite
+		if err := m.DB.Where("module_id IN (?)", moduleIDs).Order("prerequisite_id").Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, p := range rows {
+			modulePrerequisites[p.ModuleID] = append(modulePrerequisites[p.ModuleID], p.PrerequisiteID)
+		}
+	}
+	lessonPrerequisites := make(map[uint][]uint)
+	if len(lessonIDs) > 0 {
+		var rows []LessonPrerequisite
+		if err := m.DB.Where("lesson_id IN (?)", lessonIDs).Order("prerequisite_id").Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, p := range rows {
+			lessonPrerequisites[p.LessonID] = append(lessonPrerequisites[p.LessonID], p.PrerequisiteID)
+		}
+	}
+
+	for i := range course.Modules {
+		module := &course.Modules[i]
+		module.PrerequisiteIDs = modulePrerequisites[module.ID]
+		for j := range module.Lessons {
+			module.Lessons[j].PrerequisiteIDs = lessonPrerequisites[module.Lessons[j].ID]
+		}
+	}
+	if withLocks {
+		lockContent(course)
+	}
+	return nil
+}
+
+// lockContent flags the modules and lessons of the course that the user
+// still has to unlock, going by the prerequisites and progress filled in.
+func lockContent(course *Course) {
+	modules := make(map[uint]*Module, len(course.Modules))
+	lessons := make(map[uint]*Lesson)
+	for i := range course.Modules {
+		module := &course.Modules[i]
+		modules[module.ID] = module
+		for j := range module.Lessons {
+			lessons[module.Lessons[j].ID] = &module.Lessons[j]
+		}
+	}
+
+	moduleCompleted := func(module *Module) bool {
+		for _, lesson := range module.Lessons {
+			if lesson.Progress != ProgressCompleted {
+				return false
+			}
+		}
+		return true
+	}
+
+	var previous *Lesson
+	for i := range course.Modules {
+		module := &course.Modules[i]
+		for _, id := range module.PrerequisiteIDs {
+			if prerequisite, ok := modules[id]; ok && !moduleCompleted(prerequisite) {
+				module.Locked = true
+				module.LockReason = fmt.Sprintf("Complete the module %q first", prerequisite.Title)
+				break
+			}
+		}
+
+		for j := range module.Lessons {
+			lesson := &module.Lessons[j]
+			switch {
+			case module.Locked:
+				lesson.Locked = true
+				lesson.LockReason = module.LockReason
+			case course.Sequential && previous != nil && previous.Progress != ProgressCompleted:
+				lesson.Locked = true
+				lesson.LockReason = fmt.Sprintf("Complete the previous lesson %q first", previous.Title)
+			default:
+				for _, id := range lesson.PrerequisiteIDs {
+					if prerequisite, ok := lessons[id]; ok && prerequisite.Progress != ProgressCompleted {
+						lesson.Locked = true
+						lesson.LockReason = fmt.Sprintf("Complete the lesson %q first", prerequisite.Title)
+						break
+					}
+				}
+			}
+			previous = lesson
+		}
+	}
+}
+
+// LessonLock returns why the lesson is still locked for the user, or an
+// empty string when the user may open it.
+func (m PrerequisiteModel) LessonLock(courseID, lessonID, userID uint) (string, error) {
+	course, err := (CourseModel{DB: m.DB}).GetWithModulesAndLessons(courseID, userID)
+	if err != nil {
+		return "", err
+	}
+	for _, module := range course.Modules {
+		for _, lesson := range module.Lessons {
+			if lesson.ID == lessonID {
+				return lesson.LockReason, nil
+			}
+		}
+	}
+	return "", nil
+}
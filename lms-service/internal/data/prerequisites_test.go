@@ -0,0 +1,300 @@
+package data
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+// testCourse has two modules with two lessons each: lessons 11 and 12 in
+// module 1, lessons 21 and 22 in module 2.
+func testCourse(sequential bool) *Course {
+	lesson := func(id uint, title string) Lesson {
+		return Lesson{Model: gorm.Model{ID: id}, Title: title}
+	}
+	return &Course{
+		Sequential: sequential,
+		Modules: []Module{
+			{Model: gorm.Model{ID: 1}, Title: "Basics", Lessons: []Lesson{lesson(11, "Intro"), lesson(12, "Setup")}},
+			{Model: gorm.Model{ID: 2}, Title: "Advanced", Lessons: []Lesson{lesson(21, "Tuning"), lesson(22, "Wrap up")}},
+		},
+	}
+}
+
+func TestReaches(t *testing.T) {
+	l := func(id uint) prerequisiteNode { return prerequisiteNode{lessonNode, id} }
+	edges := prerequisiteGraph{
+		l(1): {l(2)},
+		l(2): {l(3), l(4)},
+		l(4): {l(2)},
+	}
+
+	tests := []struct {
+		name   string
+		from   []prerequisiteNode
+		target prerequisiteNode
+		want   bool
+	}{
+		{"no start", nil, l(1), false},
+		{"start is the target", []prerequisiteNode{l(1)}, l(1), true},
+		{"direct edge", []prerequisiteNode{l(1)}, l(2), true},
+		{"transitive", []prerequisiteNode{l(1)}, l(3), true},
+		{"against the edges", []prerequisiteNode{l(3)}, l(1), false},
+		{"through a loop", []prerequisiteNode{l(4)}, l(3), true},
+		{"any of several starts", []prerequisiteNode{l(3), l(4)}, l(2), true},
+		{"unknown node", []prerequisiteNode{l(9)}, l(1), false},
+		{"other kind with the same id", []prerequisiteNode{l(1)}, prerequisiteNode{moduleEndNode, 2}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reaches(edges, tt.from, tt.target); got != tt.want {
+				t.Errorf("reaches(%v, %v) = %v, want %v", tt.from, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestPrerequisiteGraphCycles checks a new prerequisite against the rest of
+// the course the way SetForModule and SetForLesson do.
+func TestPrerequisiteGraphCycles(t *testing.T) {
+	tests := []struct {
+		name       string
+		sequential bool
+		modules    []ModulePrerequisite
+		lessons    []LessonPrerequisite
+		// The new prerequisite, either of a module or of a lesson.
+		module *ModulePrerequisite
+		lesson *LessonPrerequisite
+		cycle  bool
+	}{
+		{
+			name:   "module on another module",
+			module: &ModulePrerequisite{ModuleID: 2, PrerequisiteID: 1},
+		},
+		{
+			name:    "modules on each other",
+			modules: []ModulePrerequisite{{ModuleID: 1, PrerequisiteID: 2}},
+			module:  &ModulePrerequisite{ModuleID: 2, PrerequisiteID: 1},
+			cycle:   true,
+		},
+		{
+			name:    "module on a module whose lesson waits for it",
+			lessons: []LessonPrerequisite{{LessonID: 21, PrerequisiteID: 12}},
+			module:  &ModulePrerequisite{ModuleID: 1, PrerequisiteID: 2},
+			cycle:   true,
+		},
+		{
+			name:    "lesson on a lesson of a module that waits for it",
+			modules: []ModulePrerequisite{{ModuleID: 1, PrerequisiteID: 2}},
+			lesson:  &LessonPrerequisite{LessonID: 21, PrerequisiteID: 12},
+			cycle:   true,
+		},
+		{
+			name:    "lesson on a lesson of a prerequisite module",
+			modules: []ModulePrerequisite{{ModuleID: 2, PrerequisiteID: 1}},
+			lesson:  &LessonPrerequisite{LessonID: 21, PrerequisiteID: 12},
+		},
+		{
+			name:    "lessons on each other",
+			lessons: []LessonPrerequisite{{LessonID: 11, PrerequisiteID: 22}},
+			lesson:  &LessonPrerequisite{LessonID: 22, PrerequisiteID: 11},
+			cycle:   true,
+		},
+		{
+			name:    "through several lessons",
+			lessons: []LessonPrerequisite{{LessonID: 11, PrerequisiteID: 22}, {LessonID: 22, PrerequisiteID: 21}},
+			lesson:  &LessonPrerequisite{LessonID: 21, PrerequisiteID: 11},
+			cycle:   true,
+		},
+		{
+			name:   "later lesson in a free course",
+			lesson: &LessonPrerequisite{LessonID: 11, PrerequisiteID: 22},
+		},
+		{
+			name:       "earlier lesson in a sequential course",
+			sequential: true,
+			lesson:     &LessonPrerequisite{LessonID: 22, PrerequisiteID: 11},
+		},
+		{
+			name:       "later lesson in a sequential course",
+			sequential: true,
+			lesson:     &LessonPrerequisite{LessonID: 11, PrerequisiteID: 12},
+			cycle:      true,
+		},
+		{
+			name:       "later module in a sequential course",
+			sequential: true,
+			module:     &ModulePrerequisite{ModuleID: 1, PrerequisiteID: 2},
+			cycle:      true,
+		},
+		{
+			name:       "earlier module in a sequential course",
+			sequential: true,
+			module:     &ModulePrerequisite{ModuleID: 2, PrerequisiteID: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edges := newPrerequisiteGraph(testCourse(tt.sequential), tt.modules, tt.lessons)
+
+			var got bool
+			if tt.module != nil {
+				got = reaches(edges, []prerequisiteNode{{moduleEndNode, tt.module.PrerequisiteID}}, prerequisiteNode{moduleStartNode, tt.module.ModuleID})
+			} else {
+				got = reaches(edges, []prerequisiteNode{{lessonNode, tt.lesson.PrerequisiteID}}, prerequisiteNode{lessonNode, tt.lesson.LessonID})
+			}
+			if got != tt.cycle {
+				t.Errorf("cycle = %v, want %v", got, tt.cycle)
+			}
+		})
+	}
+}
+
+// TestPrerequisiteGraphHasCycle checks whole courses the way reorders, moves
+// and turning on the sequential flag do.
+func TestPrerequisiteGraphHasCycle(t *testing.T) {
+	tests := []struct {
+		name       string
+		sequential bool
+		modules    []ModulePrerequisite
+		lessons    []LessonPrerequisite
+		cycle      bool
+	}{
+		{name: "nothing required"},
+		{name: "sequential course", sequential: true},
+		{
+			name:    "later lesson in a free course",
+			lessons: []LessonPrerequisite{{LessonID: 11, PrerequisiteID: 22}},
+		},
+		{
+			name:       "later lesson in a sequential course",
+			sequential: true,
+			lessons:    []LessonPrerequisite{{LessonID: 11, PrerequisiteID: 22}},
+			cycle:      true,
+		},
+		{
+			name:       "later module in a sequential course",
+			sequential: true,
+			modules:    []ModulePrerequisite{{ModuleID: 1, PrerequisiteID: 2}},
+			cycle:      true,
+		},
+		{
+			name:       "earlier module in a sequential course",
+			sequential: true,
+			modules:    []ModulePrerequisite{{ModuleID: 2, PrerequisiteID: 1}},
+			lessons:    []LessonPrerequisite{{LessonID: 22, PrerequisiteID: 11}},
+		},
+		{
+			name:    "lessons on each other",
+			lessons: []LessonPrerequisite{{LessonID: 11, PrerequisiteID: 22}, {LessonID: 22, PrerequisiteID: 11}},
+			cycle:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edges := newPrerequisiteGraph(testCourse(tt.sequential), tt.modules, tt.lessons)
+			if got := edges.hasCycle(); got != tt.cycle {
+				t.Errorf("hasCycle() = %v, want %v", got, tt.cycle)
+			}
+		})
+	}
+}
+
+// TestLockContent covers the locks ApplyToCourse flags for a student.
+func TestLockContent(t *testing.T) {
+	tests := []struct {
+		name       string
+		sequential bool
+		modules    map[uint][]uint
+		lessons    map[uint][]uint
+		completed  []uint
+		// Lock reasons by lesson id; lessons not listed are open.
+		locked map[uint]string
+	}{
+		{
+			name: "nothing required",
+		},
+		{
+			name:    "lesson waits for a lesson",
+			lessons: map[uint][]uint{22: {11}},
+			locked:  map[uint]string{22: `Complete the lesson "Intro" first`},
+		},
+		{
+			name:      "required lesson completed",
+			lessons:   map[uint][]uint{22: {11}},
+			completed: []uint{11},
+		},
+		{
+			name:      "first of several required lessons missing",
+			lessons:   map[uint][]uint{22: {11, 12}},
+			completed: []uint{11},
+			locked:    map[uint]string{22: `Complete the lesson "Setup" first`},
+		},
+		{
+			name:      "module waits for a module",
+			modules:   map[uint][]uint{2: {1}},
+			completed: []uint{11},
+			locked: map[uint]string{
+				21: `Complete the module "Basics" first`,
+				22: `Complete the module "Basics" first`,
+			},
+		},
+		{
+			name:      "required module completed",
+			modules:   map[uint][]uint{2: {1}},
+			completed: []uint{11, 12},
+		},
+		{
+			name:       "sequential course",
+			sequential: true,
+			completed:  []uint{11},
+			locked: map[uint]string{
+				21: `Complete the previous lesson "Setup" first`,
+				22: `Complete the previous lesson "Tuning" first`,
+			},
+		},
+		{
+			name:       "sequential course completed out of order",
+			sequential: true,
+			completed:  []uint{11, 21},
+			locked: map[uint]string{
+				21: `Complete the previous lesson "Setup" first`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			course := testCourse(tt.sequential)
+			completed := make(map[uint]bool)
+			for _, id := range tt.completed {
+				completed[id] = true
+			}
+			for i := range course.Modules {
+				module := &course.Modules[i]
+				module.PrerequisiteIDs = tt.modules[module.ID]
+				for j := range module.Lessons {
+					lesson := &module.Lessons[j]
+					lesson.PrerequisiteIDs = tt.lessons[lesson.ID]
+					if completed[lesson.ID] {
+						lesson.Progress = ProgressCompleted
+					}
+				}
+			}
+
+			lockContent(course)
+
+			for _, module := range course.Modules {
+				for _, lesson := range module.Lessons {
+					want, locked := tt.locked[lesson.ID]
+					if lesson.Locked != locked || lesson.LockReason != want {
+						t.Errorf("lesson %d: locked = %v %q, want %v %q", lesson.ID, lesson.Locked, lesson.LockReason, locked, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package data
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	ProgressNotStarted = "not_started"
+	ProgressInProgress = "in_progress"
+	ProgressCompleted  = "completed"
+)
+
+// LessonProgress records how far a student got with a lesson. Lessons
+// without a row have not been started.
+type LessonProgress struct {
+	ID          uint `gorm:"primary_key"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	LessonID    uint
+	UserID      uint
+	Status      string
+	StartedAt   *time.Time
+	CompletedAt *time.Time
+}
+
+type ProgressModel struct {
+	DB *gorm.DB
+}
+
+func (m ProgressModel) Get(lessonID, userID uint) (*LessonProgress, error) {
+	var progress LessonProgress
+	err := m.DB.Where("lesson_id = ? AND user_id = ?", lessonID, userID).First(&progress).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &LessonProgress{LessonID: lessonID, UserID: userID, Status: ProgressNotStarted}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &progress, nil
+}
+
+// MarkStarted moves a lesson that was not started yet to in progress.
+func (m ProgressModel) MarkStarted(lessonID, userID uint) error {
+	return m.DB.Exec(`INSERT INTO lesson_progresses (lesson_id, user_id, status, started_at)
+		VALUES (?, ?, ?, NOW())
+		ON CONFLICT (lesson_id, user_id) DO NOTHING`, lessonID, userID, ProgressInProgress).Error
+}
+
+// MarkCompleted completes the lesson. Completing it again keeps the time of
+// the first completion.
+func (m ProgressModel) MarkCompleted(lessonID, userID uint) (*LessonProgress, error) {
+	err := m.DB.Exec(`INSERT INTO lesson_progresses (lesson_id, user_id, status, started_at, completed_at)
+		VALUES (?, ?, ?, NOW(), NOW())
+		ON CONFLICT (lesson_id, user_id) DO UPDATE
+		SET status = EXCLUDED.status,
+		    completed_at = COALESCE(lesson_progresses.completed_at, EXCLUDED.completed_at),
+		    updated_at = NOW()`, lessonID, userID, ProgressCompleted).Error
+	if err != nil {
+		return nil, err
+	}
+	return m.Get(lessonID, userID)
+}
+
+// ApplyToCourse fills in the progress of the user on every lesson of the
+// course and the completion percentages of its modules and of the course.
+// The course has to be loaded with its modules and lessons.
+func (m ProgressModel) ApplyToCourse(course *Course, userID uint) error {
+	var lessonIDs []uint
+	for _, module := range course.Modules {
+		for _, lesson := range module.Lessons {
+			lessonIDs = append(lessonIDs, lesson.ID)
+		}
+	}
+
+	statuses := make(map[uint]string, len(lessonIDs))
+	if len(lessonIDs) > 0 {
+		var progresses []LessonProgress
+		if err := m.DB.Where("user_id = ? AND lesson_id IN (?)", userID, lessonIDs).Find(&progresses).Error; err != nil {
+			return err
+		}
+		for _, p := range progresses {
+			statuses[p.LessonID] = p.Status
+		}
+	}
+
+	var courseCompleted int
+	for i := range course.Modules {
+		module := &course.Modules[i]
+		var moduleCompleted int
+		for j := range module.Lessons {
+			lesson := &module.Lessons[j]
+			lesson.Progress = ProgressNotStarted
+			if status, ok := statuses[lesson.ID]; ok {
+				lesson.Progress = status
+			}
+			if lesson.Progress == ProgressCompleted {
+				moduleCompleted++
+			}
+		}
+		module.CompletionPercent = completionPercent(moduleCompleted, len(module.Lessons))
+		courseCompleted += moduleCompleted
+	}
+	course.CompletionPercent = completionPercent(courseCompleted, len(lessonIDs))
+	return nil
+}
+
+// CourseCompletionPercent returns how much of the course the user completed.
+func (m ProgressModel) CourseCompletionPercent(courseID, userID uint) (float64, error) {
+	var counts struct {
+		Total     int
+		Completed int
+	}
+	err := m.DB.Raw(`SELECT COUNT(lessons.id) AS total,
+			COUNT(lesson_progresses.id) FILTER (WHERE lesson_progresses.status = ?) AS completed
+		FROM lessons
+		JOIN modules ON modules.id = lessons.module_id
+		LEFT JOIN lesson_progresses ON lesson_progresses.lesson_id = lessons.id AND lesson_progresses.user_id = ?
+		WHERE modules.course_id = ? AND lessons.deleted_at IS NULL AND modules.deleted_at IS NULL`,
+		ProgressCompleted, userID, courseID).Scan(&counts).Error
+	if err != nil {
+		return 0, err
+	}
+	return *completionPercent(counts.Completed, counts.Total), nil
+}
+
+func completionPercent(completed, total int) *float64 {
+	percent := 0.0
+	if total > 0 {
+		percent = float64(completed) * 100 / float64(total)
+	}
+	return &percent
+}
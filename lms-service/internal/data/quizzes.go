@@ -0,0 +1,467 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	QuestionSingleChoice   = "single_choice"
+	QuestionMultipleChoice = "multiple_choice"
+	QuestionTrueFalse      = "true_false"
+	QuestionShortAnswer    = "short_answer"
+	QuestionNumeric        = "numeric"
+)
+
+// submissionGrace is added to the time limit of an attempt to make up for
+// network latency between the student pressing submit and the request
+// arriving.
+const submissionGrace = 30 * time.Second
+
+var (
+	ErrNoAttemptsLeft      = errors.New("no attempts left for this quiz")
+	ErrAttemptSubmitted    = errors.New("the attempt has already been submitted")
+	ErrAttemptExpired      = errors.New("the time limit of the attempt has passed")
+	ErrAttemptNotSubmitted = errors.New("the attempt has not been submitted yet")
+)
+
+// Quiz is attached either to a lesson or to a module. MaxAttempts and
+// TimeLimitSeconds are unlimited when zero.
+type Quiz struct {
+	gorm.Model
+	LessonID         *uint
+	ModuleID         *uint
+	Title            string
+	MaxAttempts      int
+	TimeLimitSeconds int
+	ShuffleQuestions bool
+	CategoryID       *uint
+	Questions        []QuizQuestion
+}
+
+// QuizQuestion holds the expected answer next to the prompt. The answer
+// fields are cleared by HideAnswers before a quiz is shown to students.
+type QuizQuestion struct {
+	ID              uint `gorm:"primary_key"`
+	QuizID          uint
+	Position        int
+	Type            string
+	Prompt          string
+	Points          float64
+	CorrectAnswer   string       `json:",omitempty"`
+	AcceptedAnswers StringList   `json:",omitempty"`
+	Tolerance       float64      `json:",omitempty"`
+	Options         []QuizOption `gorm:"foreignkey:QuestionID"`
+}
+
+type QuizOption struct {
+	ID         uint `gorm:"primary_key"`
+	QuestionID uint
+	Position   int
+	Text       string
+	Correct    bool `json:",omitempty"`
+}
+
+type QuizAttempt struct {
+	ID            uint `gorm:"primary_key"`
+	QuizID        uint
+	UserID        uint
+	QuestionOrder UintList `json:"-"`
+	StartedAt     time.Time
+	DeadlineAt    *time.Time
+	SubmittedAt   *time.Time
+	Score         float64
+	MaxScore      float64
+	Answers       []QuizAnswer `gorm:"foreignkey:AttemptID" json:",omitempty"`
+}
+
+type QuizAnswer struct {
+	ID         uint `gorm:"primary_key"`
+	AttemptID  uint
+	QuestionID uint
+	OptionIDs  UintList `gorm:"column:option_ids"`
+	Answer     string
+	Correct    bool
+	Points     float64
+}
+
+// Validate checks that the question can be graded automatically.
+func (q *QuizQuestion) Validate() error {
+	if strings.TrimSpace(q.Prompt) == "" {
+		return errors.New("question prompt must not be empty")
+	}
+	if q.Points < 0 {
+		return errors.New("question points must not be negative")
+	}
+
+	correct := 0
+	for _, o := range q.Options {
+		if o.Correct {
+			correct++
+		}
+	}
+
+	switch q.Type {
+	case QuestionSingleChoice:
+		if len(q.Options) < 2 || correct != 1 {
+			return errors.New("single choice questions need at least two options and exactly one correct option")
+		}
+	case QuestionMultipleChoice:
+		if len(q.Options) < 2 || correct < 1 {
+			return errors.New("multiple choice questions need at least two options and at least one correct option")
+		}
+	case QuestionTrueFalse:
+		if _, err := strconv.ParseBool(q.CorrectAnswer); err != nil {
+			return errors.New("true/false questions need correct_answer set to true or false")
+		}
+	case QuestionShortAnswer:
+		if len(q.AcceptedAnswers) == 0 {
+			return errors.New("short answer questions need at least one accepted answer")
+		}
+	case QuestionNumeric:
+		if _, err := strconv.ParseFloat(q.CorrectAnswer, 64); err != nil {
+			return errors.New("numeric questions need a numeric correct_answer")
+		}
+		if q.Tolerance < 0 {
+			return errors.New("tolerance must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown question type %q", q.Type)
+	}
+	return nil
+}
+
+// Grade checks a response against the question. Choice questions only score
+// when exactly the correct options are selected.
+func (q *QuizQuestion) Grade(optionIDs []uint, answer string) bool {
+	answer = strings.TrimSpace(answer)
+
+	switch q.Type {
+	case QuestionSingleChoice, QuestionMultipleChoice:
+		selected := make(map[uint]bool, len(optionIDs))
+		for _, id := range optionIDs {
+			selected[id] = true
+		}
+		if q.Type == QuestionSingleChoice && len(selected) != 1 {
+			return false
+		}
+		matched := 0
+		for _, o := range q.Options {
+			if o.Correct != selected[o.ID] {
+				return false
+			}
+			if selected[o.ID] {
+				matched++
+			}
+		}
+		// Fails when ids of options from other questions were selected.
+		return matched == len(selected)
+	case QuestionTrueFalse:
+		expected, err1 := strconv.ParseBool(q.CorrectAnswer)
+		given, err2 := strconv.ParseBool(answer)
+		return err1 == nil && err2 == nil && expected == given
+	case QuestionShortAnswer:
+		for _, accepted := range q.AcceptedAnswers {
+			if strings.EqualFold(strings.TrimSpace(accepted), answer) {
+				return true
+			}
+		}
+		return false
+	case QuestionNumeric:
+		expected, err1 := strconv.ParseFloat(q.CorrectAnswer, 64)
+		given, err2 := strconv.ParseFloat(answer, 64)
+		return err1 == nil && err2 == nil && math.Abs(expected-given) <= q.Tolerance
+	}
+	return false
+}
+
+// AnswersRevealed reports whether a student who has started attemptsUsed
+// attempts may see the correct answers. That is only the case once no
+// attempts are left, so quizzes with unlimited attempts never reveal them.
+func (quiz *Quiz) AnswersRevealed(attemptsUsed int) bool {
+	return quiz.MaxAttempts > 0 && attemptsUsed >= quiz.MaxAttempts
+}
+
+// HideAnswers removes everything that would give the answers away.
+func (quiz *Quiz) HideAnswers() {
+	for i := range quiz.Questions {
+		q := &quiz.Questions[i]
+		q.CorrectAnswer = ""
+		q.AcceptedAnswers = nil
+		q.Tolerance = 0
+		for j := range q.Options {
+			q.Options[j].Correct = false
+		}
+	}
+}
+
+// OrderQuestions sorts the questions in the order they were shown in an
+// attempt.
+func (quiz *Quiz) OrderQuestions(order []uint) {
+	byID := make(map[uint]QuizQuestion, len(quiz.Questions))
+	for _, q := range quiz.Questions {
+		byID[q.ID] = q
+	}
+	ordered := make([]QuizQuestion, 0, len(order))
+	for _, id := range order {
+		if q, ok := byID[id]; ok {
+			ordered = append(ordered, q)
+		}
+	}
+	quiz.Questions = ordered
+}
+
+func (quiz *Quiz) MaxScore() float64 {
+	var total float64
+	for _, q := range quiz.Questions {
+		total += q.Points
+	}
+	return total
+}
+
+type QuizModel struct {
+	DB *gorm.DB
+}
+
+func preloadQuestions(db *gorm.DB) *gorm.DB {
+	return db.Preload("Questions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("quiz_questions.position, quiz_questions.id")
+	}).Preload("Questions.Options", func(db *gorm.DB) *gorm.DB {
+		return db.Order("quiz_options.position, quiz_options.id")
+	})
+}
+
+// Insert creates the quiz together with its questions and options.
+func (m QuizModel) Insert(quiz *Quiz) error {
+	return m.DB.Create(quiz).Error
+}
+
+func (m QuizModel) Get(id uint) (*Quiz, error) {
+	var quiz Quiz
+	if err := preloadQuestions(m.DB).First(&quiz, id).Error; err != nil {
+		return nil, err
+	}
+	return &quiz, nil
+}
+
+func (m QuizModel) GetAllForLesson(lessonID uint) ([]Quiz, error) {
+	var quizzes []Quiz
+	if err := m.DB.Where("lesson_id = ?", lessonID).Order("id").Find(&quizzes).Error; err != nil {
+		return nil, err
+	}
+	return quizzes, nil
+}
+
+func (m QuizModel) GetAllForModule(moduleID uint) ([]Quiz, error) {
+	var quizzes []Quiz
+	if err := m.DB.Where("module_id = ?", moduleID).Order("id").Find(&quizzes).Error; err != nil {
+		return nil, err
+	}
+	return quizzes, nil
+}
+
+// UpdateSettings saves the quiz settings without touching its questions.
+func (m QuizModel) UpdateSettings(quiz *Quiz) error {
+	return m.DB.Model(quiz).Updates(map[string]interface{}{
+		"title":              quiz.Title,
+		"max_attempts":       quiz.MaxAttempts,
+		"time_limit_seconds": quiz.TimeLimitSeconds,
+		"shuffle_questions":  quiz.ShuffleQuestions,
+		"category_id":        quiz.CategoryID,
+	}).Error
+}
+
+func (m QuizModel) Delete(id uint) error {
+	return m.DB.Delete(&Quiz{}, id).Error
+}
+
+// GetCourseID returns the id of the course the quiz belongs to.
+func (m QuizModel) GetCourseID(quiz *Quiz) (uint, error) {
+	var module Module
+	query := m.DB.Select("modules.course_id")
+	if quiz.LessonID != nil {
+		query = query.Joins("JOIN lessons ON lessons.module_id = modules.id").Where("lessons.id = ?", *quiz.LessonID)
+	} else {
+		query = query.Where("modules.id = ?", *quiz.ModuleID)
+	}
+	if err := query.First(&module).Error; err != nil {
+		return 0, err
+	}
+	return module.CourseID, nil
+}
+
+// StartAttempt opens a new attempt for the user. An attempt that is still
+// running is returned instead, so reloading the page does not use up
+// attempts. The quiz row is locked to count attempts reliably.
+func (m QuizModel) StartAttempt(quizID, userID uint) (*QuizAttempt, error) {
+	tx := m.DB.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer tx.Rollback()
+
+	var quiz Quiz
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&quiz, quizID).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var running QuizAttempt
+	err := tx.Where("quiz_id = ? AND user_id = ? AND submitted_at IS NULL AND (deadline_at IS NULL OR deadline_at > ?)", quizID, userID, now).
+		First(&running).Error
+	if err == nil {
+		return &running, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	}
+
+	if quiz.MaxAttempts > 0 {
+		var used int
+		if err := tx.Model(&QuizAttempt{}).Where("quiz_id = ? AND user_id = ?", quizID, userID).Count(&used).Error; err != nil {
+			return nil, err
+		}
+		if used >= quiz.MaxAttempts {
+			return nil, ErrNoAttemptsLeft
+		}
+	}
+
+	var questionIDs []uint
+	if err := tx.Model(&QuizQuestion{}).Where("quiz_id = ?", quizID).Order("position, id").Pluck("id", &questionIDs).Error; err != nil {
+		return nil, err
+	}
+	if quiz.ShuffleQuestions {
+		rand.Shuffle(len(questionIDs), func(i, j int) {
+			questionIDs[i], questionIDs[j] = questionIDs[j], questionIDs[i]
+		})
+	}
+
+	attempt := &QuizAttempt{
+		QuizID:        quizID,
+		UserID:        userID,
+		QuestionOrder: questionIDs,
+		StartedAt:     now,
+	}
+	if quiz.TimeLimitSeconds > 0 {
+		deadline := now.Add(time.Duration(quiz.TimeLimitSeconds) * time.Second)
+		attempt.DeadlineAt = &deadline
+	}
+
+	if err := tx.Create(attempt).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return attempt, nil
+}
+
+func (m QuizModel) GetAttempt(id uint) (*QuizAttempt, error) {
+	var attempt QuizAttempt
+	if err := m.DB.Preload("Answers").First(&attempt, id).Error; err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (m QuizModel) GetAttemptsForUser(quizID, userID uint) ([]QuizAttempt, error) {
+	var attempts []QuizAttempt
+	if err := m.DB.Where("quiz_id = ? AND user_id = ?", quizID, userID).Order("started_at").Find(&attempts).Error; err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// SubmittedAnswer is a response to one question of an attempt.
+type SubmittedAnswer struct {
+	QuestionID uint   `json:"question_id"`
+	OptionIDs  []uint `json:"option_ids"`
+	Answer     string `json:"answer"`
+}
+
+// SubmitAttempt grades the answers and closes the attempt. Answers that
+// arrive after the time limit are discarded; the attempt is still closed and
+// ErrAttemptExpired is returned along with it.
+func (m QuizModel) SubmitAttempt(attemptID uint, answers []SubmittedAnswer) (*QuizAttempt, error) {
+	tx := m.DB.Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer tx.Rollback()
+
+	var attempt QuizAttempt
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&attempt, attemptID).Error; err != nil {
+		return nil, err
+	}
+	if attempt.SubmittedAt != nil {
+		return nil, ErrAttemptSubmitted
+	}
+
+	quiz, err := QuizModel{DB: tx}.Get(attempt.QuizID)
+	if err != nil {
+		return nil, err
+	}
+	quiz.OrderQuestions(attempt.QuestionOrder)
+
+	now := time.Now()
+	expired := attempt.DeadlineAt != nil && now.After(attempt.DeadlineAt.Add(submissionGrace))
+	if expired {
+		answers = nil
+	}
+
+	byQuestion := make(map[uint]SubmittedAnswer, len(answers))
+	for _, a := range answers {
+		byQuestion[a.QuestionID] = a
+	}
+
+	attempt.Score = 0
+	attempt.MaxScore = quiz.MaxScore()
+	attempt.Answers = nil
+	for i := range quiz.Questions {
+		question := &quiz.Questions[i]
+		submitted, ok := byQuestion[question.ID]
+		if !ok {
+			continue
+		}
+
+		answer := QuizAnswer{
+			AttemptID:  attempt.ID,
+			QuestionID: question.ID,
+			OptionIDs:  submitted.OptionIDs,
+			Answer:     submitted.Answer,
+			Correct:    question.Grade(submitted.OptionIDs, submitted.Answer),
+		}
+		if answer.Correct {
+			answer.Points = question.Points
+			attempt.Score += question.Points
+		}
+		if err := tx.Create(&answer).Error; err != nil {
+			return nil, err
+		}
+		attempt.Answers = append(attempt.Answers, answer)
+	}
+
+	attempt.SubmittedAt = &now
+	if err := tx.Model(&QuizAttempt{ID: attempt.ID}).Updates(map[string]interface{}{
+		"submitted_at": attempt.SubmittedAt,
+		"score":        attempt.Score,
+		"max_score":    attempt.MaxScore,
+	}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	if expired {
+		return &attempt, ErrAttemptExpired
+	}
+	return &attempt, nil
+}
@@ -0,0 +1,100 @@
+package data
+
+import "testing"
+
+func TestAnswersRevealed(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		attemptsUsed int
+		want         bool
+	}{
+		{"unlimited attempts", 0, 10, false},
+		{"attempts left", 3, 1, false},
+		{"last attempt used", 3, 3, true},
+		{"more attempts than allowed", 1, 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quiz := Quiz{MaxAttempts: tt.maxAttempts}
+			if got := quiz.AnswersRevealed(tt.attemptsUsed); got != tt.want {
+				t.Errorf("AnswersRevealed(%d) = %v, want %v", tt.attemptsUsed, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestStudentReviewHidesAnswers follows the student path of a review: with
+// attempts left, nothing in the questions may give the answers away.
+func TestStudentReviewHidesAnswers(t *testing.T) {
+	quiz := Quiz{
+		MaxAttempts: 2,
+		Questions: []QuizQuestion{
+			{Type: QuestionSingleChoice, Options: []QuizOption{{ID: 1, Correct: true}, {ID: 2}}},
+			{Type: QuestionShortAnswer, AcceptedAnswers: StringList{"go"}},
+			{Type: QuestionNumeric, CorrectAnswer: "3.14", Tolerance: 0.01},
+		},
+	}
+
+	if quiz.AnswersRevealed(1) {
+		t.Fatal("answers revealed while an attempt is left")
+	}
+	quiz.HideAnswers()
+
+	for i, q := range quiz.Questions {
+		if q.CorrectAnswer != "" || q.AcceptedAnswers != nil || q.Tolerance != 0 {
+			t.Errorf("question %d still has its answer: %+v", i, q)
+		}
+		for _, o := range q.Options {
+			if o.Correct {
+				t.Errorf("question %d still marks option %d as correct", i, o.ID)
+			}
+		}
+	}
+}
+
+func TestQuizQuestionGrade(t *testing.T) {
+	single := QuizQuestion{Type: QuestionSingleChoice, Options: []QuizOption{{ID: 1, Correct: true}, {ID: 2}}}
+	multiple := QuizQuestion{Type: QuestionMultipleChoice, Options: []QuizOption{{ID: 1, Correct: true}, {ID: 2, Correct: true}, {ID: 3}}}
+	trueFalse := QuizQuestion{Type: QuestionTrueFalse, CorrectAnswer: "true"}
+	short := QuizQuestion{Type: QuestionShortAnswer, AcceptedAnswers: StringList{"Paris", " paris city "}}
+	numeric := QuizQuestion{Type: QuestionNumeric, CorrectAnswer: "3.14", Tolerance: 0.01}
+
+	tests := []struct {
+		name      string
+		question  QuizQuestion
+		optionIDs []uint
+		answer    string
+		want      bool
+	}{
+		{"single correct", single, []uint{1}, "", true},
+		{"single wrong", single, []uint{2}, "", false},
+		{"single two options", single, []uint{1, 2}, "", false},
+		{"single nothing selected", single, nil, "", false},
+		{"single duplicate id", single, []uint{1, 1}, "", true},
+		{"multiple all correct", multiple, []uint{2, 1}, "", true},
+		{"multiple partially correct", multiple, []uint{1}, "", false},
+		{"multiple with a wrong option", multiple, []uint{1, 2, 3}, "", false},
+		{"multiple with a foreign option", multiple, []uint{1, 2, 99}, "", false},
+		{"true false correct", trueFalse, nil, " TRUE ", true},
+		{"true false wrong", trueFalse, nil, "false", false},
+		{"true false garbage", trueFalse, nil, "yes", false},
+		{"short answer ignores case", short, nil, "PARIS", true},
+		{"short answer trims accepted", short, nil, "paris city", true},
+		{"short answer wrong", short, nil, "London", false},
+		{"numeric exact", numeric, nil, "3.14", true},
+		{"numeric within tolerance", numeric, nil, "3.145", true},
+		{"numeric outside tolerance", numeric, nil, "3.2", false},
+		{"numeric not a number", numeric, nil, "pi", false},
+		{"unknown type", QuizQuestion{Type: "essay"}, nil, "anything", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.question.Grade(tt.optionIDs, tt.answer); got != tt.want {
+				t.Errorf("Grade(%v, %q) = %v, want %v", tt.optionIDs, tt.answer, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	RevisionCourse = "course"
+	RevisionModule = "module"
+	RevisionLesson = "lesson"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// RevisionContent holds the editable text fields of a course, module or
+// lesson at one point in time.
+type RevisionContent map[string]string
+
+func (rc RevisionContent) Value() (driver.Value, error) {
+	if rc == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(rc)
+	return string(b), err
+}
+
+func (rc *RevisionContent) Scan(src interface{}) error {
+	return scanJSON(src, rc)
+}
+
+// Revision is one saved version of a course, module or lesson. Versions
+// are numbered from 1 per entity.
+type Revision struct {
+	ID           uint `gorm:"primary_key"`
+	CreatedAt    time.Time
+	EntityType   string
+	EntityID     uint
+	Version      int
+	AuthorID     uint
+	AuthorEmail  string
+	RestoredFrom *int
+	Content      RevisionContent
+}
+
+// RevisionMeta describes who made an edit.
+type RevisionMeta struct {
+	AuthorID    uint
+	AuthorEmail string
+	// RestoredFrom is the version brought back by a restore.
+	RestoredFrom *int
+}
+
+// Revisioned is content whose edits are kept as revisions.
+type Revisioned interface {
+	revisionKey() (entityType string, id uint)
+	revisionContent() RevisionContent
+	applyRevision(content RevisionContent)
+	save(tx *gorm.DB) error
+}
+
+func (c *Course) revisionKey() (string, uint) { return RevisionCourse, c.ID }
+
+func (c *Course) revisionContent() RevisionContent {
+	return RevisionContent{"title": c.Title, "description": c.Description}
+}
+
+func (c *Course) applyRevision(content RevisionContent) {
+	c.Title = content["title"]
+	c.Description = content["description"]
+}
+
+func (c *Course) save(tx *gorm.DB) error {
+	return tx.Omit("status", "publish_at", "published_at").Save(c).Error
+}
+
+func (m *Module) revisionKey() (string, uint) { return RevisionModule, m.ID }
+
+func (m *Module) revisionContent() RevisionContent {
+	return RevisionContent{"title": m.Title}
+}
+
+func (m *Module) applyRevision(content RevisionContent) {
+	m.Title = content["title"]
+}
+
+func (m *Module) save(tx *gorm.DB) error {
+	return tx.Omit("position").Save(m).Error
+}
+
+func (l *Lesson) revisionKey() (string, uint) { return RevisionLesson, l.ID }
+
+func (l *Lesson) revisionContent() RevisionContent {
+	return RevisionContent{"title": l.Title, "link": l.Link, "conspect": l.Conspect}
+}
+
+func (l *Lesson) applyRevision(content RevisionContent) {
+	l.Title = content["title"]
+	l.Link = content["link"]
+	l.Conspect = content["conspect"]
+}
+
+func (l *Lesson) save(tx *gorm.DB) error {
+	return tx.Omit("position", "module_id").Save(l).Error
+}
+
+// recordRevision stores the current content of entity as its next version.
+// It runs after the entity row was written in the same transaction, so
+// concurrent edits of the same entity wait for each other.
+func recordRevision(tx *gorm.DB, entity Revisioned, meta RevisionMeta) error {
+	entityType, id := entity.revisionKey()
+	var version int
+	err := tx.Model(&Revision{}).
+		Where("entity_type = ? AND entity_id = ?", entityType, id).
+		Select("COALESCE(MAX(version), 0) + 1").
+		Row().Scan(&version)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&Revision{
+		EntityType:   entityType,
+		EntityID:     id,
+		Version:      version,
+		AuthorID:     meta.AuthorID,
+		AuthorEmail:  meta.AuthorEmail,
+		RestoredFrom: meta.RestoredFrom,
+		Content:      entity.revisionContent(),
+	}).Error
+}
+
+// saveWithRevision saves the entity and records the edit.
+func saveWithRevision(db *gorm.DB, entity Revisioned, meta RevisionMeta) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := entity.save(tx); err != nil {
+			return err
+		}
+		return recordRevision(tx, entity, meta)
+	})
+}
+
+type RevisionModel struct {
+	DB *gorm.DB
+}
+
+// GetAll returns the revisions of an entity, newest first.
+func (m RevisionModel) GetAll(entity Revisioned) ([]Revision, error) {
+	entityType, id := entity.revisionKey()
+	var revisions []Revision
+	err := m.DB.Where("entity_type = ? AND entity_id = ?", entityType, id).Order("version DESC").Find(&revisions).Error
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (m RevisionModel) Get(entity Revisioned, version int) (*Revision, error) {
+	entityType, id := entity.revisionKey()
+	var revision Revision
+	err := m.DB.Where("entity_type = ? AND entity_id = ? AND version = ?", entityType, id, version).First(&revision).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// Restore brings back the content of an older version. The restore is
+// recorded as a new revision, so it can be undone like any other edit.
+func (m RevisionModel) Restore(entity Revisioned, version int, meta RevisionMeta) error {
+	revision, err := m.Get(entity, version)
+	if err != nil {
+		return err
+	}
+	entity.applyRevision(revision.Content)
+	meta.RestoredFrom = &revision.Version
+	return saveWithRevision(m.DB, entity, meta)
+}
+
+// DiffLine is one line of a field diff. Op is "+" for added, "-" for removed
+// and " " for unchanged lines.
+type DiffLine struct {
+	Op   string
+	Text string
+}
+
+// FieldDiff lists the line changes of one field between two revisions.
+type FieldDiff struct {
+	Field string
+	Lines []DiffLine
+}
+
+// Diff compares the content of two revisions field by field. Unchanged
+// fields are left out.
+func Diff(from, to *Revision) []FieldDiff {
+	fields := make(map[string]bool)
+	for field := range from.Content {
+		fields[field] = true
+	}
+	for field := range to.Content {
+		fields[field] = true
+	}
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+
+	diffs := []FieldDiff{}
+	for _, field := range names {
+		before, after := from.Content[field], to.Content[field]
+		if before == after {
+			continue
+		}
+		diffs = append(diffs, FieldDiff{Field: field, Lines: diffLines(splitLines(before), splitLines(after))})
+	}
+	return diffs
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines builds a line diff from the longest common subsequence of a
+// and b.
+func diffLines(a, b []string) []DiffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, DiffLine{Op: " ", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, DiffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			lines = append(lines, DiffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, DiffLine{Op: "-", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, DiffLine{Op: "+", Text: b[j]})
+	}
+	return lines
+}
@@ -0,0 +1,39 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		// Each line is the op followed by the text.
+		want []string
+	}{
+		{"both empty", nil, nil, nil},
+		{"unchanged", []string{"a", "b"}, []string{"a", "b"}, []string{" a", " b"}},
+		{"added", nil, []string{"a", "b"}, []string{"+a", "+b"}},
+		{"removed", []string{"a", "b"}, nil, []string{"-a", "-b"}},
+		{"appended", []string{"a"}, []string{"a", "b"}, []string{" a", "+b"}},
+		{"first line removed", []string{"a", "b"}, []string{"b"}, []string{"-a", " b"}},
+		{"changed line", []string{"a", "b", "c"}, []string{"a", "x", "c"}, []string{" a", "-b", "+x", " c"}},
+		{"replaced", []string{"x"}, []string{"y"}, []string{"-x", "+y"}},
+		{"moved line", []string{"a", "b", "c"}, []string{"c", "a", "b"}, []string{"+c", " a", " b", "-c"}},
+		{"repeated lines", []string{"a", "a"}, []string{"a", "b", "a"}, []string{" a", "+b", " a"}},
+		{"blank lines", []string{"a", "", "b"}, []string{"a", "b"}, []string{" a", "-", " b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, line := range diffLines(tt.a, tt.b) {
+				got = append(got, line.Op+line.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffLines(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package data
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SearchResult is a course, module or lesson matching a search. Snippet is
+// an HTML escaped excerpt with the matches wrapped in <mark> tags.
+type SearchResult struct {
+	Type     string
+	ID       uint
+	CourseID uint
+	ModuleID *uint `json:",omitempty"`
+	Title    string
+	Snippet  string
+	Rank     float64
+	// TitleSnippet highlights the title alone, for lessons the caller
+	// may not open.
+	TitleSnippet string `json:"-"`
+}
+
+// HideContent limits the snippet to the title.
+func (r *SearchResult) HideContent() {
+	r.Snippet = r.TitleSnippet
+}
+
+// SearchFilter narrows a search to one type of content or to one course.
+type SearchFilter struct {
+	Type     string
+	CourseID uint
+}
+
+type SearchModel struct {
+	DB *gorm.DB
+}
+
+// ts_headline wraps the matches in these control characters. They are only
+// turned into <mark> tags after the snippet was escaped, see highlight.
+const (
+	markStart = "\x02"
+	markStop  = "\x03"
+)
+
+const headlineOptions = `'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxWords=30, MinWords=10, MaxFragments=2'`
+
+// headline highlights the matches in text with the stemmer that found them.
+func headline(text string) string {
+	return fmt.Sprintf(`CASE WHEN to_tsvector('english', %[1]s) @@ search.en
+		THEN ts_headline('english', %[1]s, search.en, %[2]s)
+		ELSE ts_headline('russian', %[1]s, search.ru, %[2]s) END`, text, headlineOptions)
+}
+
+var markReplacer = strings.NewReplacer(markStart, "<mark>", markStop, "</mark>")
+
+// highlight escapes the content of a headline so that it is safe to show as
+// HTML and marks the matches with <mark> tags.
+func highlight(snippet string) string {
+	return markReplacer.Replace(html.EscapeString(snippet))
+}
+
+// Search finds the content matching text, best matches first, among the
+// courses the viewer may see. text accepts the web search syntax: quoted
+// phrases, OR and -word. It returns one page and the number of matches.
+// Lesson snippets quote the conspect; callers hide it with HideContent for
+// lessons the viewer may not open.
+func (m SearchModel) Search(text string, filter SearchFilter, viewer CourseViewer, limit, offset int) ([]SearchResult, int64, error) {
+	visible, visibleArgs := viewer.condition()
+
+	type branch struct {
+		kind, sql string
+	}
+	branches := []branch{
+		{"course", `SELECT 'course' AS type, courses.id, courses.id AS course_id, NULL::integer AS module_id, courses.title,
+			` + headline("coalesce(courses.title, '') || '. ' || coalesce(courses.description, '')") + ` AS snippet,
+			ts_rank(courses.search_vector, search.en || search.ru) AS rank,
+			'' AS title_snippet
+			FROM courses, search
+			WHERE courses.deleted_at IS NULL AND courses.search_vector @@ (search.en || search.ru)`},
+		{"module", `SELECT 'module', modules.id, modules.course_id, NULL, modules.title,
+			` + headline("coalesce(modules.title, '')") + `,
+			ts_rank(modules.search_vector, search.en || search.ru),
+			''
+			FROM modules JOIN courses ON courses.id = modules.course_id, search
+			WHERE modules.deleted_at IS NULL AND courses.deleted_at IS NULL AND modules.search_vector @@ (search.en || search.ru)`},
+		{"lesson", `SELECT 'lesson', lessons.id, modules.course_id, lessons.module_id, lessons.title,
+			` + headline("coalesce(lessons.title, '') || '. ' || coalesce(lessons.conspect, '')") + `,
+			ts_rank(lessons.search_vector, search.en || search.ru),
+			` + headline("coalesce(lessons.title, '')") + `
+			FROM lessons JOIN modules ON modules.id = lessons.module_id JOIN courses ON courses.id = modules.course_id, search
+			WHERE lessons.deleted_at IS NULL AND modules.deleted_at IS NULL AND courses.deleted_at IS NULL
+				AND lessons.search_vector @@ (search.en || search.ru)`},
+	}
+
+	var parts []string
+	args := []interface{}{text, text}
+	for _, b := range branches {
+		if filter.Type != "" && filter.Type != b.kind {
+			continue
+		}
+		sql := b.sql + " AND " + visible
+		args = append(args, visibleArgs...)
+		if filter.CourseID != 0 {
+			sql += " AND courses.id = ?"
+			args = append(args, filter.CourseID)
+		}
+		parts = append(parts, sql)
+	}
+
+	from := `WITH search AS (SELECT websearch_to_tsquery('english', ?) AS en, websearch_to_tsquery('russian', ?) AS ru)
+		SELECT * FROM (` + strings.Join(parts, " UNION ALL ") + `) results`
+
+	var total int64
+	if err := m.DB.Raw("SELECT count(*) FROM ("+from+") counted", args...).Row().Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	results := []SearchResult{}
+	err := m.DB.Raw(from+" ORDER BY rank DESC, type, id LIMIT ? OFFSET ?", append(args, limit, offset)...).Scan(&results).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range results {
+		results[i].Snippet = highlight(results[i].Snippet)
+		results[i].TitleSnippet = highlight(results[i].TitleSnippet)
+	}
+	return results, total, nil
+}
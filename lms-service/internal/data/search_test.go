@@ -0,0 +1,27 @@
+package data
+
+import "testing"
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet string
+		want    string
+	}{
+		{"plain text", "Intro to Go", "Intro to Go"},
+		{"match", "Intro to \x02Go\x03", "Intro to <mark>Go</mark>"},
+		{"several matches", "\x02Go\x03 and \x02Go\x03", "<mark>Go</mark> and <mark>Go</mark>"},
+		{"markup in content", `<img src=x onerror="alert(1)">`, "&lt;img src=x onerror=&#34;alert(1)&#34;&gt;"},
+		{"markup in a match", "\x02<script>\x03", "<mark>&lt;script&gt;</mark>"},
+		{"mark tags in content", "<mark>Go</mark>", "&lt;mark&gt;Go&lt;/mark&gt;"},
+		{"entities", "Q&A", "Q&amp;A"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlight(tt.snippet); got != tt.want {
+				t.Errorf("highlight(%q) = %q, want %q", tt.snippet, got, tt.want)
+			}
+		})
+	}
+}
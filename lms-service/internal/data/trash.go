@@ -0,0 +1,199 @@
+package data
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	TrashCourse = "course"
+	TrashModule = "module"
+	TrashLesson = "lesson"
+)
+
+var (
+	ErrNotInTrash    = errors.New("the item is not in the trash")
+	ErrParentDeleted = errors.New("restore the course or module this item belongs to first")
+)
+
+// TrashItem is a deleted course, module or lesson. Modules and lessons that
+// were deleted together with their course or module are not listed on
+// their own, they come back when the parent is restored.
+type TrashItem struct {
+	Type      string
+	ID        uint
+	Title     string
+	CourseID  uint
+	DeletedAt time.Time
+}
+
+type TrashModel struct {
+	DB *gorm.DB
+}
+
+// Get returns the deleted item or ErrNotInTrash.
+func (m TrashModel) Get(itemType string, id uint) (*TrashItem, error) {
+	var query string
+	switch itemType {
+	case TrashCourse:
+		query = `SELECT 'course' AS type, id, title, id AS course_id, deleted_at FROM courses WHERE id = ? AND deleted_at IS NOT NULL`
+	case TrashModule:
+		query = `SELECT 'module' AS type, id, title, course_id, deleted_at FROM modules WHERE id = ? AND deleted_at IS NOT NULL`
+	case TrashLesson:
+		query = `SELECT 'lesson' AS type, lessons.id, lessons.title, modules.course_id, lessons.deleted_at
+			FROM lessons JOIN modules ON modules.id = lessons.module_id
+			WHERE lessons.id = ? AND lessons.deleted_at IS NOT NULL`
+	default:
+		return nil, ErrNotInTrash
+	}
+
+	var items []TrashItem
+	if err := m.DB.Raw(query, id).Scan(&items).Error; err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, ErrNotInTrash
+	}
+	return &items[0], nil
+}
+
+// GetAll lists the trash of the courses the viewer may edit, most recently
+// deleted first. Publishers and course managers see every course.
+func (m TrashModel) GetAll(viewer CourseViewer) ([]TrashItem, error) {
+	filter, args := "TRUE", []interface{}{}
+	if !viewer.Publisher {
+		filter = `(courses.owner_id = ? OR courses.id IN (SELECT course_id FROM course_collaborators WHERE user_id = ?))`
+		args = []interface{}{viewer.UserID, viewer.UserID}
+	}
+
+	query := `
+		SELECT 'course' AS type, courses.id, courses.title, courses.id AS course_id, courses.deleted_at
+		FROM courses
+		WHERE courses.deleted_at IS NOT NULL AND ` + filter + `
+		UNION ALL
+		SELECT 'module', modules.id, modules.title, modules.course_id, modules.deleted_at
+		FROM modules JOIN courses ON courses.id = modules.course_id
+		WHERE modules.deleted_at IS NOT NULL
+			AND (courses.deleted_at IS NULL OR courses.deleted_at <> modules.deleted_at) AND ` + filter + `
+		UNION ALL
+		SELECT 'lesson', lessons.id, lessons.title, modules.course_id, lessons.deleted_at
+		FROM lessons JOIN modules ON modules.id = lessons.module_id JOIN courses ON courses.id = modules.course_id
+		WHERE lessons.deleted_at IS NOT NULL
+			AND (modules.deleted_at IS NULL OR modules.deleted_at <> lessons.deleted_at) AND ` + filter + `
+		ORDER BY deleted_at DESC`
+
+	var items []TrashItem
+	if err := m.DB.Raw(query, append(append(append([]interface{}{}, args...), args...), args...)...).Scan(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// deleteCourse soft deletes the course with its modules and lessons. They
+// all get the same deleted_at, which is how Restore finds them again.
+func deleteCourse(tx *gorm.DB, id uint, now time.Time) error {
+	if err := tx.Exec(`UPDATE lessons SET deleted_at = ? WHERE deleted_at IS NULL
+		AND module_id IN (SELECT id FROM modules WHERE course_id = ? AND deleted_at IS NULL)`, now, id).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`UPDATE modules SET deleted_at = ? WHERE course_id = ? AND deleted_at IS NULL`, now, id).Error; err != nil {
+		return err
+	}
+	return tx.Exec(`UPDATE courses SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, now, id).Error
+}
+
+// deleteModule soft deletes the module with its lessons.
+func deleteModule(tx *gorm.DB, id uint, now time.Time) error {
+	if err := tx.Exec(`UPDATE lessons SET deleted_at = ? WHERE module_id = ? AND deleted_at IS NULL`, now, id).Error; err != nil {
+		return err
+	}
+	return tx.Exec(`UPDATE modules SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, now, id).Error
+}
+
+// Restore takes the item out of the trash together with the modules and
+// lessons that were deleted with it.
+func (m TrashModel) Restore(item *TrashItem) error {
+	return m.DB.Transaction(func(tx *gorm.DB) error {
+		switch item.Type {
+		case TrashCourse:
+			if err := tx.Exec(`UPDATE lessons SET deleted_at = NULL WHERE deleted_at = ?
+				AND module_id IN (SELECT id FROM modules WHERE course_id = ?)`, item.DeletedAt, item.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec(`UPDATE modules SET deleted_at = NULL WHERE course_id = ? AND deleted_at = ?`, item.ID, item.DeletedAt).Error; err != nil {
+				return err
+			}
+			return tx.Exec(`UPDATE courses SET deleted_at = NULL WHERE id = ?`, item.ID).Error
+
+		case TrashModule:
+			var parentDeleted int
+			if err := tx.Table("courses").Where("id = ? AND deleted_at IS NOT NULL", item.CourseID).Count(&parentDeleted).Error; err != nil {
+				return err
+			}
+			if parentDeleted > 0 {
+				return ErrParentDeleted
+			}
+			if err := tx.Exec(`UPDATE lessons SET deleted_at = NULL WHERE module_id = ? AND deleted_at = ?`, item.ID, item.DeletedAt).Error; err != nil {
+				return err
+			}
+			return tx.Exec(`UPDATE modules SET deleted_at = NULL WHERE id = ?`, item.ID).Error
+
+		case TrashLesson:
+			var parentDeleted int
+			err := tx.Table("lessons").
+				Joins("JOIN modules ON modules.id = lessons.module_id").
+				Where("lessons.id = ? AND modules.deleted_at IS NOT NULL", item.ID).
+				Count(&parentDeleted).Error
+			if err != nil {
+				return err
+			}
+			if parentDeleted > 0 {
+				return ErrParentDeleted
+			}
+			return tx.Exec(`UPDATE lessons SET deleted_at = NULL WHERE id = ?`, item.ID).Error
+		}
+		return ErrNotInTrash
+	})
+}
+
+// Purge permanently deletes what has been in the trash since before cutoff.
+// Modules and lessons go with their course through the foreign keys. It
+// returns the storage keys of the submitted files that were removed, so the
+// caller can delete them from storage.
+func (m TrashModel) Purge(cutoff time.Time) (purged int64, storageKeys []string, err error) {
+	err = m.DB.Transaction(func(tx *gorm.DB) error {
+		var files []SubmissionFile
+		err := tx.Select("submission_files.storage_key").
+			Joins("JOIN submissions ON submissions.id = submission_files.submission_id").
+			Joins("JOIN assignments ON assignments.id = submissions.assignment_id").
+			Joins("JOIN modules ON modules.id = assignments.module_id").
+			Joins("JOIN courses ON courses.id = modules.course_id").
+			Where("modules.deleted_at < ? OR courses.deleted_at < ?", cutoff, cutoff).
+			Find(&files).Error
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			storageKeys = append(storageKeys, file.StorageKey)
+		}
+
+		for _, table := range []string{"lessons", "modules", "courses"} {
+			result := tx.Exec(`DELETE FROM `+table+` WHERE deleted_at < ?`, cutoff)
+			if result.Error != nil {
+				return result.Error
+			}
+			purged += result.RowsAffected
+		}
+
+		return tx.Exec(`DELETE FROM revisions WHERE
+			(entity_type = 'course' AND entity_id NOT IN (SELECT id FROM courses)) OR
+			(entity_type = 'module' AND entity_id NOT IN (SELECT id FROM modules)) OR
+			(entity_type = 'lesson' AND entity_id NOT IN (SELECT id FROM lessons))`).Error
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return purged, storageKeys, nil
+}
@@ -20,6 +20,18 @@ func NotFoundResponse(c *gin.Context) {
 	c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
 }
 
+func ForbiddenResponse(c *gin.Context, message string) {
+	c.JSON(http.StatusForbidden, gin.H{"error": message})
+}
+
+func ConflictResponse(c *gin.Context, err error) {
+	c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+}
+
+func RequestTooLargeResponse(c *gin.Context, err error) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+}
+
 func WriteJSON(c *gin.Context, statusCode int, data gin.H) {
 	c.JSON(statusCode, data)
 }
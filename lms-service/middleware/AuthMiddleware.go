@@ -9,15 +9,28 @@ import (
 )
 
 type Claims struct {
-	Username    string `json:"username"`
-	IsActivated bool   `json:"isActivated"`
-	Email       string `json:"email"`
-	UserId      uint   `json:"userId"`
-	ROLE        string `json:"role"`
+	Username     string   `json:"username"`
+	IsActivated  bool     `json:"isActivated"`
+	Email        string   `json:"email"`
+	UserId       uint     `json:"userId"`
+	ROLE         string   `json:"role"`
+	TokenVersion int      `json:"tokenVersion"`
+	Permissions  []string `json:"permissions"`
+	Language     string   `json:"language,omitempty"`
 	jwt.StandardClaims
 }
 
-func AuthMiddleware(secretKey string) gin.HandlerFunc {
+// HasPermission reports whether the token grants permission.
+func (c *Claims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func AuthMiddleware(keyFunc jwt.Keyfunc, revocations RevocationChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -33,9 +46,7 @@ func AuthMiddleware(secretKey string) gin.HandlerFunc {
 			return
 		}
 
-		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secretKey), nil
-		})
+		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, keyFunc)
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -43,14 +54,50 @@ func AuthMiddleware(secretKey string) gin.HandlerFunc {
 			return
 		}
 
-		if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-			c.Set("claims", claims)
-		} else {
+		claims, ok := token.Claims.(*Claims)
+		if !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 			c.Abort()
 			return
 		}
 
+		revoked, err := revocations.IsRevoked(tokenString, claims)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Could not verify token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		c.Set("claims", claims)
+
+		c.Next()
+	}
+}
+
+// ClaimsFromContext returns the claims stored by AuthMiddleware, or nil on
+// routes without it.
+func ClaimsFromContext(c *gin.Context) *Claims {
+	value, _ := c.Get("claims")
+	claims, _ := value.(*Claims)
+	return claims
+}
+
+// RequirePermission only lets requests through whose token grants
+// permission. It has to run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := ClaimsFromContext(c)
+		if claims == nil || !claims.HasPermission(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to perform this action"})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// minJWKSRefreshInterval limits how often an unknown kid may trigger a
+// refetch, so tokens with made-up kids cannot flood the auth service.
+const minJWKSRefreshInterval = 10 * time.Second
+
+// JWKS fetches the public keys of the authentication service and caches them.
+// The set is refreshed after ttl, or earlier when a token names a kid that is
+// not cached yet, which happens right after a key rotation.
+type JWKS struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func NewJWKS(url string, ttl time.Duration) *JWKS {
+	return &JWKS{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+		keys:   make(map[string]*rsa.PublicKey),
+	}
+}
+
+// Keyfunc resolves the verification key for a token. Only RSA signatures are
+// accepted.
+func (j *JWKS) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+	return j.key(kid)
+}
+
+func (j *JWKS) key(kid string) (*rsa.PublicKey, error) {
+	j.mu.RLock()
+	key, ok := j.keys[kid]
+	age := time.Since(j.fetchedAt)
+	j.mu.RUnlock()
+
+	if ok && age < j.ttl {
+		return key, nil
+	}
+	if ok || age >= minJWKSRefreshInterval {
+		if err := j.refresh(); err != nil {
+			// Keep serving known keys while the auth service is unreachable.
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+	}
+
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	key, ok = j.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (j *JWKS) refresh() error {
+	resp, err := j.client.Get(j.url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return fmt.Errorf("invalid modulus for key %s: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return fmt.Errorf("invalid exponent for key %s: %w", k.Kid, err)
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.fetchedAt = time.Now()
+	j.mu.Unlock()
+	return nil
+}
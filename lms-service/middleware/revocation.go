@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RevocationChecker decides whether a token that passed signature
+// verification has been revoked since it was issued.
+type RevocationChecker interface {
+	IsRevoked(tokenString string, claims *Claims) (bool, error)
+}
+
+// AuthServiceRevocationChecker asks the authentication service whether a
+// token is still valid and remembers positive answers for ttl, so not every
+// request results in a round trip. A token revoked within that window is
+// still accepted until its cached answer expires.
+type AuthServiceRevocationChecker struct {
+	validateURL string
+	ttl         time.Duration
+	client      *http.Client
+
+	mu    sync.Mutex
+	valid map[string]time.Time
+}
+
+func NewAuthServiceRevocationChecker(authURL string, ttl time.Duration) *AuthServiceRevocationChecker {
+	return &AuthServiceRevocationChecker{
+		validateURL: authURL + "/auth/validate-token",
+		ttl:         ttl,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		valid:       make(map[string]time.Time),
+	}
+}
+
+func (rc *AuthServiceRevocationChecker) IsRevoked(tokenString string, claims *Claims) (bool, error) {
+	now := time.Now()
+
+	rc.mu.Lock()
+	validUntil, ok := rc.valid[claims.Id]
+	rc.mu.Unlock()
+	if ok && claims.Id != "" && now.Before(validUntil) {
+		return false, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, rc.validateURL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+
+	resp, err := rc.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to reach authentication service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if claims.Id != "" {
+			rc.remember(claims.Id, now.Add(rc.ttl))
+		}
+		return false, nil
+	case http.StatusUnauthorized:
+		return true, nil
+	default:
+		return false, fmt.Errorf("authentication service responded with status %d", resp.StatusCode)
+	}
+}
+
+func (rc *AuthServiceRevocationChecker) remember(jti string, validUntil time.Time) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	// Drop stale entries from time to time so the cache does not grow
+	// without bound.
+	if len(rc.valid) > 10000 {
+		now := time.Now()
+		for k, v := range rc.valid {
+			if now.After(v) {
+				delete(rc.valid, k)
+			}
+		}
+	}
+	rc.valid[jti] = validUntil
+}
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE courses ADD COLUMN owner_id INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE course_collaborators (
+                         id SERIAL PRIMARY KEY,
+                         created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         course_id INTEGER NOT NULL REFERENCES courses (id) ON DELETE CASCADE,
+                         user_id INTEGER NOT NULL,
+                         UNIQUE (course_id, user_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE course_collaborators;
+ALTER TABLE courses DROP COLUMN owner_id;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE courses
+    ADD COLUMN capacity INTEGER,
+    ADD COLUMN enrollment_opens_at TIMESTAMP,
+    ADD COLUMN enrollment_closes_at TIMESTAMP;
+
+CREATE TABLE enrollments (
+                         id SERIAL PRIMARY KEY,
+                         created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         course_id INTEGER NOT NULL REFERENCES courses (id) ON DELETE CASCADE,
+                         user_id INTEGER NOT NULL,
+                         email TEXT NOT NULL,
+                         UNIQUE (course_id, user_id)
+);
+
+CREATE INDEX enrollments_user_id_idx ON enrollments (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE enrollments;
+ALTER TABLE courses
+    DROP COLUMN capacity,
+    DROP COLUMN enrollment_opens_at,
+    DROP COLUMN enrollment_closes_at;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE lesson_progresses (
+                         id SERIAL PRIMARY KEY,
+                         created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         lesson_id INTEGER NOT NULL REFERENCES lessons (id) ON DELETE CASCADE,
+                         user_id INTEGER NOT NULL,
+                         status TEXT NOT NULL DEFAULT 'not_started',
+                         started_at TIMESTAMP,
+                         completed_at TIMESTAMP,
+                         UNIQUE (lesson_id, user_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE lesson_progresses;
+-- +goose StatementEnd
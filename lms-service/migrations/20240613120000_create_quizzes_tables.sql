@@ -0,0 +1,69 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE quizzes (
+                         id SERIAL PRIMARY KEY,
+                         created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         deleted_at TIMESTAMP,
+                         lesson_id INTEGER REFERENCES lessons (id) ON DELETE CASCADE,
+                         module_id INTEGER REFERENCES modules (id) ON DELETE CASCADE,
+                         title TEXT NOT NULL,
+                         max_attempts INTEGER NOT NULL DEFAULT 0,
+                         time_limit_seconds INTEGER NOT NULL DEFAULT 0,
+                         shuffle_questions BOOLEAN NOT NULL DEFAULT FALSE,
+                         CHECK ((lesson_id IS NULL) <> (module_id IS NULL))
+);
+
+CREATE TABLE quiz_questions (
+                         id SERIAL PRIMARY KEY,
+                         quiz_id INTEGER NOT NULL REFERENCES quizzes (id) ON DELETE CASCADE,
+                         position INTEGER NOT NULL DEFAULT 0,
+                         type TEXT NOT NULL,
+                         prompt TEXT NOT NULL,
+                         points DOUBLE PRECISION NOT NULL DEFAULT 1,
+                         correct_answer TEXT NOT NULL DEFAULT '',
+                         accepted_answers TEXT NOT NULL DEFAULT '[]',
+                         tolerance DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE TABLE quiz_options (
+                         id SERIAL PRIMARY KEY,
+                         question_id INTEGER NOT NULL REFERENCES quiz_questions (id) ON DELETE CASCADE,
+                         position INTEGER NOT NULL DEFAULT 0,
+                         text TEXT NOT NULL,
+                         correct BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE quiz_attempts (
+                         id SERIAL PRIMARY KEY,
+                         quiz_id INTEGER NOT NULL REFERENCES quizzes (id) ON DELETE CASCADE,
+                         user_id INTEGER NOT NULL,
+                         question_order TEXT NOT NULL DEFAULT '[]',
+                         started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         deadline_at TIMESTAMP,
+                         submitted_at TIMESTAMP,
+                         score DOUBLE PRECISION NOT NULL DEFAULT 0,
+                         max_score DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE INDEX quiz_attempts_quiz_id_user_id_idx ON quiz_attempts (quiz_id, user_id);
+
+CREATE TABLE quiz_answers (
+                         id SERIAL PRIMARY KEY,
+                         attempt_id INTEGER NOT NULL REFERENCES quiz_attempts (id) ON DELETE CASCADE,
+                         question_id INTEGER NOT NULL REFERENCES quiz_questions (id) ON DELETE CASCADE,
+                         option_ids TEXT NOT NULL DEFAULT '[]',
+                         answer TEXT NOT NULL DEFAULT '',
+                         correct BOOLEAN NOT NULL DEFAULT FALSE,
+                         points DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE quiz_answers;
+DROP TABLE quiz_attempts;
+DROP TABLE quiz_options;
+DROP TABLE quiz_questions;
+DROP TABLE quizzes;
+-- +goose StatementEnd
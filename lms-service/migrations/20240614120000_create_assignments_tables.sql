@@ -0,0 +1,73 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE assignments (
+                         id SERIAL PRIMARY KEY,
+                         created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         deleted_at TIMESTAMP,
+                         module_id INTEGER NOT NULL REFERENCES modules (id) ON DELETE CASCADE,
+                         title TEXT NOT NULL,
+                         description TEXT,
+                         due_at TIMESTAMP,
+                         max_points DOUBLE PRECISION NOT NULL DEFAULT 100,
+                         allow_late BOOLEAN NOT NULL DEFAULT FALSE,
+                         allow_resubmission BOOLEAN NOT NULL DEFAULT TRUE,
+                         allow_text BOOLEAN NOT NULL DEFAULT TRUE,
+                         allow_files BOOLEAN NOT NULL DEFAULT TRUE,
+                         max_files INTEGER NOT NULL DEFAULT 5,
+                         max_file_size_bytes BIGINT NOT NULL DEFAULT 10485760,
+                         allowed_extensions TEXT NOT NULL DEFAULT '[]'
+);
+
+CREATE TABLE rubric_criteria (
+                         id SERIAL PRIMARY KEY,
+                         assignment_id INTEGER NOT NULL REFERENCES assignments (id) ON DELETE CASCADE,
+                         position INTEGER NOT NULL DEFAULT 0,
+                         title TEXT NOT NULL,
+                         max_points DOUBLE PRECISION NOT NULL
+);
+
+CREATE TABLE submissions (
+                         id SERIAL PRIMARY KEY,
+                         created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         assignment_id INTEGER NOT NULL REFERENCES assignments (id) ON DELETE CASCADE,
+                         user_id INTEGER NOT NULL,
+                         email TEXT NOT NULL,
+                         text TEXT,
+                         submitted_at TIMESTAMP NOT NULL,
+                         late BOOLEAN NOT NULL DEFAULT FALSE,
+                         grade DOUBLE PRECISION,
+                         feedback TEXT,
+                         graded_at TIMESTAMP,
+                         graded_by INTEGER,
+                         UNIQUE (assignment_id, user_id)
+);
+
+CREATE TABLE submission_files (
+                         id SERIAL PRIMARY KEY,
+                         submission_id INTEGER NOT NULL REFERENCES submissions (id) ON DELETE CASCADE,
+                         file_name TEXT NOT NULL,
+                         content_type TEXT NOT NULL,
+                         size BIGINT NOT NULL,
+                         storage_key TEXT NOT NULL
+);
+
+CREATE TABLE rubric_scores (
+                         id SERIAL PRIMARY KEY,
+                         submission_id INTEGER NOT NULL REFERENCES submissions (id) ON DELETE CASCADE,
+                         criterion_id INTEGER NOT NULL REFERENCES rubric_criteria (id) ON DELETE CASCADE,
+                         points DOUBLE PRECISION NOT NULL,
+                         comment TEXT,
+                         UNIQUE (submission_id, criterion_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE rubric_scores;
+DROP TABLE submission_files;
+DROP TABLE submissions;
+DROP TABLE rubric_criteria;
+DROP TABLE assignments;
+-- +goose StatementEnd
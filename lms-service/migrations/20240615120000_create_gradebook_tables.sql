@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE grade_categories (
+                         id SERIAL PRIMARY KEY,
+                         course_id INTEGER NOT NULL REFERENCES courses (id) ON DELETE CASCADE,
+                         name TEXT NOT NULL,
+                         weight DOUBLE PRECISION NOT NULL,
+                         drop_lowest INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE gradebook_settings (
+                         course_id INTEGER PRIMARY KEY REFERENCES courses (id) ON DELETE CASCADE,
+                         late_penalty_per_day DOUBLE PRECISION NOT NULL DEFAULT 0,
+                         max_late_penalty DOUBLE PRECISION NOT NULL DEFAULT 100,
+                         letter_scale TEXT NOT NULL DEFAULT '[]'
+);
+
+CREATE TABLE grade_overrides (
+                         id SERIAL PRIMARY KEY,
+                         updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         course_id INTEGER NOT NULL REFERENCES courses (id) ON DELETE CASCADE,
+                         user_id INTEGER NOT NULL,
+                         item_key TEXT NOT NULL,
+                         points DOUBLE PRECISION NOT NULL,
+                         UNIQUE (course_id, user_id, item_key)
+);
+
+ALTER TABLE quizzes ADD COLUMN category_id INTEGER REFERENCES grade_categories (id) ON DELETE SET NULL;
+ALTER TABLE assignments ADD COLUMN category_id INTEGER REFERENCES grade_categories (id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE assignments DROP COLUMN category_id;
+ALTER TABLE quizzes DROP COLUMN category_id;
+DROP TABLE grade_overrides;
+DROP TABLE gradebook_settings;
+DROP TABLE grade_categories;
+-- +goose StatementEnd
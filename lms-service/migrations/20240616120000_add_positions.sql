@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE modules ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE lessons ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+
+UPDATE modules SET position = ordered.position
+FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY course_id ORDER BY id) - 1 AS position FROM modules) ordered
+WHERE modules.id = ordered.id;
+
+UPDATE lessons SET position = ordered.position
+FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY module_id ORDER BY id) - 1 AS position FROM lessons) ordered
+WHERE lessons.id = ordered.id;
+
+CREATE INDEX modules_course_id_position_idx ON modules (course_id, position);
+CREATE INDEX lessons_module_id_position_idx ON lessons (module_id, position);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX lessons_module_id_position_idx;
+DROP INDEX modules_course_id_position_idx;
+ALTER TABLE lessons DROP COLUMN position;
+ALTER TABLE modules DROP COLUMN position;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE courses ADD COLUMN sequential BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE module_prerequisites (
+                         module_id INTEGER NOT NULL REFERENCES modules (id) ON DELETE CASCADE,
+                         prerequisite_id INTEGER NOT NULL REFERENCES modules (id) ON DELETE CASCADE,
+                         PRIMARY KEY (module_id, prerequisite_id)
+);
+
+CREATE TABLE lesson_prerequisites (
+                         lesson_id INTEGER NOT NULL REFERENCES lessons (id) ON DELETE CASCADE,
+                         prerequisite_id INTEGER NOT NULL REFERENCES lessons (id) ON DELETE CASCADE,
+                         PRIMARY KEY (lesson_id, prerequisite_id)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE lesson_prerequisites;
+DROP TABLE module_prerequisites;
+ALTER TABLE courses DROP COLUMN sequential;
+-- +goose StatementEnd
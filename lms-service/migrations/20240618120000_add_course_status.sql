@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE courses ADD COLUMN status TEXT NOT NULL DEFAULT 'draft';
+ALTER TABLE courses ADD COLUMN publish_at TIMESTAMP;
+ALTER TABLE courses ADD COLUMN published_at TIMESTAMP;
+
+-- Courses created before the workflow existed were already visible.
+UPDATE courses SET status = 'published', published_at = created_at;
+
+CREATE INDEX courses_scheduled_publish_idx ON courses (publish_at) WHERE status = 'review';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX courses_scheduled_publish_idx;
+ALTER TABLE courses DROP COLUMN published_at;
+ALTER TABLE courses DROP COLUMN publish_at;
+ALTER TABLE courses DROP COLUMN status;
+-- +goose StatementEnd
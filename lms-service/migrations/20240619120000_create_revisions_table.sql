@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE revisions (
+                         id SERIAL PRIMARY KEY,
+                         created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                         entity_type TEXT NOT NULL,
+                         entity_id INTEGER NOT NULL,
+                         version INTEGER NOT NULL,
+                         author_id INTEGER NOT NULL DEFAULT 0,
+                         author_email TEXT NOT NULL DEFAULT '',
+                         restored_from INTEGER,
+                         content TEXT NOT NULL,
+                         UNIQUE (entity_type, entity_id, version)
+);
+
+-- The current text of existing content becomes its first revision.
+INSERT INTO revisions (created_at, entity_type, entity_id, version, author_id, content)
+SELECT updated_at, 'course', id, 1, owner_id, json_build_object('title', title, 'description', description)::text FROM courses;
+
+INSERT INTO revisions (created_at, entity_type, entity_id, version, content)
+SELECT updated_at, 'module', id, 1, json_build_object('title', title)::text FROM modules;
+
+INSERT INTO revisions (created_at, entity_type, entity_id, version, content)
+SELECT updated_at, 'lesson', id, 1, json_build_object('title', title, 'link', link, 'conspect', conspect)::text FROM lessons;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE revisions;
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+-- deleted_at defaulted to the insert time, which marked every row as
+-- deleted. Rows whose deleted_at still equals created_at were never deleted.
+ALTER TABLE courses ALTER COLUMN deleted_at DROP NOT NULL, ALTER COLUMN deleted_at DROP DEFAULT;
+ALTER TABLE modules ALTER COLUMN deleted_at DROP NOT NULL, ALTER COLUMN deleted_at DROP DEFAULT;
+ALTER TABLE lessons ALTER COLUMN deleted_at DROP NOT NULL, ALTER COLUMN deleted_at DROP DEFAULT;
+
+UPDATE courses SET deleted_at = NULL WHERE deleted_at = created_at;
+UPDATE modules SET deleted_at = NULL WHERE deleted_at = created_at;
+UPDATE lessons SET deleted_at = NULL WHERE deleted_at = created_at;
+
+CREATE INDEX courses_deleted_at_idx ON courses (deleted_at);
+CREATE INDEX modules_deleted_at_idx ON modules (deleted_at);
+CREATE INDEX lessons_deleted_at_idx ON lessons (deleted_at);
+
+-- Purging a course from the trash removes its modules and lessons with it.
+ALTER TABLE modules DROP CONSTRAINT modules_course_id_fkey,
+    ADD CONSTRAINT modules_course_id_fkey FOREIGN KEY (course_id) REFERENCES courses (id) ON DELETE CASCADE;
+ALTER TABLE lessons DROP CONSTRAINT lessons_module_id_fkey,
+    ADD CONSTRAINT lessons_module_id_fkey FOREIGN KEY (module_id) REFERENCES modules (id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE lessons DROP CONSTRAINT lessons_module_id_fkey,
+    ADD CONSTRAINT lessons_module_id_fkey FOREIGN KEY (module_id) REFERENCES modules (id);
+ALTER TABLE modules DROP CONSTRAINT modules_course_id_fkey,
+    ADD CONSTRAINT modules_course_id_fkey FOREIGN KEY (course_id) REFERENCES courses (id);
+
+DROP INDEX lessons_deleted_at_idx;
+DROP INDEX modules_deleted_at_idx;
+DROP INDEX courses_deleted_at_idx;
+
+UPDATE courses SET deleted_at = created_at WHERE deleted_at IS NULL;
+UPDATE modules SET deleted_at = created_at WHERE deleted_at IS NULL;
+UPDATE lessons SET deleted_at = created_at WHERE deleted_at IS NULL;
+
+ALTER TABLE courses ALTER COLUMN deleted_at SET DEFAULT CURRENT_TIMESTAMP, ALTER COLUMN deleted_at SET NOT NULL;
+ALTER TABLE modules ALTER COLUMN deleted_at SET DEFAULT CURRENT_TIMESTAMP, ALTER COLUMN deleted_at SET NOT NULL;
+ALTER TABLE lessons ALTER COLUMN deleted_at SET DEFAULT CURRENT_TIMESTAMP, ALTER COLUMN deleted_at SET NOT NULL;
+-- +goose StatementEnd
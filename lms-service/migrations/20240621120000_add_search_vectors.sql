@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Content is written in Russian and English, so every text is indexed with
+-- both stemmers.
+ALTER TABLE courses ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('russian', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+    setweight(to_tsvector('russian', coalesce(description, '')), 'B')
+) STORED;
+
+ALTER TABLE modules ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('russian', coalesce(title, '')), 'A')
+) STORED;
+
+ALTER TABLE lessons ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('russian', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(conspect, '')), 'B') ||
+    setweight(to_tsvector('russian', coalesce(conspect, '')), 'B')
+) STORED;
+
+CREATE INDEX courses_search_vector_idx ON courses USING GIN (search_vector);
+CREATE INDEX modules_search_vector_idx ON modules USING GIN (search_vector);
+CREATE INDEX lessons_search_vector_idx ON lessons USING GIN (search_vector);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE lessons DROP COLUMN search_vector;
+ALTER TABLE modules DROP COLUMN search_vector;
+ALTER TABLE courses DROP COLUMN search_vector;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE courses ADD COLUMN scheduled_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE courses ADD COLUMN scheduled_by_language TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE courses DROP COLUMN scheduled_by_language;
+ALTER TABLE courses DROP COLUMN scheduled_by;
+-- +goose StatementEnd
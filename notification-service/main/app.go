@@ -1,10 +1,8 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/joho/godotenv"
-	"github.com/jordan-wright/email"
 	"github.com/pressly/goose"
 	"github.com/streadway/amqp"
 	"gorm.io/driver/postgres"
@@ -12,9 +10,7 @@ import (
 	"gorm.io/gorm/logger"
 	"log"
 	"net/http"
-	"net/smtp"
 	"os"
-	"time"
 )
 
 const (
@@ -25,11 +21,7 @@ const (
 	dbname   = "lms_notfication"
 )
 
-var (
-	db             *gorm.DB
-	jwtSecret      = []byte("JWT_SECRET")
-	tokenExpiresIn = time.Hour * 24
-)
+var db *gorm.DB
 
 func failOnError(err error, msg string) {
 	if err != nil {
@@ -37,13 +29,6 @@ func failOnError(err error, msg string) {
 	}
 }
 
-type Notification struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	MessageTo string    `json:"messageTo"`
-	Content   string    `json:"content"`
-	SentAt    time.Time `json:"sentAt"`
-}
-
 func main() {
 	// Set up logging to a file
 	logFile, err := os.OpenFile("app.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
@@ -59,7 +44,7 @@ func main() {
 	db := initDB(dsn)
 
 	// Loading .env file
-	err := godotenv.Load()
+	err = godotenv.Load()
 	if err != nil {
 		log.Fatalf("Error loading .env file")
 	}
@@ -76,8 +61,8 @@ func main() {
 	}
 	log.Println("Database migrations applied successfully")
 
-	// Auto migrate Notification model
-	db.AutoMigrate(&Notification{})
+	// Auto migrate the models
+	db.AutoMigrate(&Notification{}, &DeadLetter{})
 	log.Println("Database migrated")
 
 	// RabbitMQ
@@ -92,42 +77,53 @@ func main() {
 	defer ch.Close()
 	log.Println("RabbitMQ channel opened")
 
-	q, err := ch.QueueDeclare(
-		"notification_queue",
-		false,
-		false,
-		false,
-		false,
-		nil,
-	)
-	failOnError(err, "Failed to declare a queue")
-
-	msgs, err := ch.Consume(
-		q.Name,
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	failOnError(err, "Failed to register a consumer")
-
-	forever := make(chan bool)
+	err = declareQueues(ch)
+	failOnError(err, "Failed to declare the queues")
+
+	// Deliver one notification at a time; unacknowledged ones are redelivered
+	// if the service stops.
+	err = ch.Qos(1, 0, false)
+	failOnError(err, "Failed to set the prefetch count")
+
+	transport := smtpTransportFromEnv()
+	log.Printf("Sending email through %s:%s", transport.Host, transport.Port)
+
+	templatesDir := os.Getenv("TEMPLATES_DIR")
+	if templatesDir == "" {
+		templatesDir = "./templates"
+	}
+	templates, err := loadTemplates(templatesDir)
+	failOnError(err, "Failed to load the email templates")
 
 	go func() {
-		for d := range msgs {
-			log.Printf("Received a notification: %s", d.Body)
-		}
+		err := consumeNotifications(ch, db, transport, templates)
+		failOnError(err, "Failed to register a consumer")
+		log.Fatalf("RabbitMQ channel closed, stopping")
 	}()
-
-	log.Printf(" [*] Waiting for notifications. To exit press CTRL+C")
-	<-forever
+	go func() {
+		err := consumeDeadLetters(ch, db)
+		failOnError(err, "Failed to register the dead-letter consumer")
+		log.Fatalf("RabbitMQ channel closed, stopping")
+	}()
+	log.Printf(" [*] Waiting for notifications")
 
 	// HTTP
-	log.Println("Сервер запущен на :8080")
-	http.ListenAndServe(":8080", nil)
+	authURL := os.Getenv("AUTH_URL")
+	if authURL == "" {
+		authURL = "http://localhost:8080"
+	}
+	deadLetters := &deadLetterHandlers{db: db, ch: ch}
+	http.HandleFunc("/notifications/dead-letters", requirePermission(authURL, manageNotificationsPermission, deadLetters.list))
+	http.HandleFunc("/notifications/dead-letters/", requirePermission(authURL, manageNotificationsPermission, deadLetters.redrive))
+
+	addr := os.Getenv("HTTP_ADDR")
+	if addr == "" {
+		addr = ":8081"
+	}
+	log.Printf("Сервер запущен на %s", addr)
+	log.Fatal(http.ListenAndServe(addr, nil))
 }
+
 func initDB(dsn string) *gorm.DB {
 	var err error
 	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
@@ -138,16 +134,3 @@ func initDB(dsn string) *gorm.DB {
 	}
 	return db
 }
-
-func SendEmail(to, activationLink string) error {
-	from := os.Getenv("SMTP_MAIL")
-	pass := os.Getenv("SMTP_KEY")
-
-	e := email.NewEmail()
-	e.From = from
-	e.To = []string{to}
-	e.Subject = "ActivateHandler your account"
-	e.HTML = []byte(fmt.Sprintf("Click <a href=\"%s/activate/%s\">here</a> to activate your account", os.Getenv("API_URL"), activationLink))
-
-	return e.Send("smtp.gmail.com:587", smtp.PlainAuth("", from, pass, "smtp.gmail.com"))
-}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/streadway/amqp"
+	"gorm.io/gorm"
+	"lms-shared/query"
+	"lms-shared/query/gormv2"
+)
+
+// manageNotificationsPermission guards the dead-letter endpoints.
+const manageNotificationsPermission = "notification:manage"
+
+// DeadLetter is a notification that could not be delivered after all retries,
+// or that was malformed. RedrivenAt is set once it was queued again.
+type DeadLetter struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Body       string     `json:"body"`
+	Error      string     `json:"error"`
+	Attempts   int        `json:"attempts"`
+	RedrivenAt *time.Time `json:"redrivenAt"`
+}
+
+// consumeDeadLetters moves messages from the dead-letter queue into the
+// dead_letters table, where administrators can inspect and re-drive them.
+func consumeDeadLetters(ch *amqp.Channel, db *gorm.DB) error {
+	msgs, err := ch.Consume(deadLetterQueue, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	for d := range msgs {
+		cause, _ := d.Headers[lastErrorHeader].(string)
+		deadLetter := DeadLetter{Body: string(d.Body), Error: cause, Attempts: attemptOf(d)}
+		if err := db.Create(&deadLetter).Error; err != nil {
+			log.Printf("Failed to save a dead letter: %v", err)
+			// Back off so an unavailable database does not spin the queue.
+			time.Sleep(time.Second)
+			d.Nack(false, true)
+			continue
+		}
+		d.Ack(false)
+	}
+	return nil
+}
+
+var deadLetterListSpec = query.Spec{
+	Sort: map[string]query.SortField{
+		"id":         {Column: "id", Field: "ID"},
+		"created_at": {Column: "created_at", Field: "CreatedAt"},
+	},
+	DefaultSort: "-created_at",
+	Filters: map[string]query.Filter{
+		"redriven":       query.Bool("(redriven_at IS NOT NULL)"),
+		"error":          query.Contains("error"),
+		"created_after":  query.After("created_at"),
+		"created_before": query.Before("created_at"),
+	},
+}
+
+type deadLetterHandlers struct {
+	db *gorm.DB
+	ch *amqp.Channel
+}
+
+// list handles GET /notifications/dead-letters.
+func (h *deadLetterHandlers) list(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, err := query.Parse(r.URL.Query(), deadLetterListSpec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var deadLetters []DeadLetter
+	metadata, err := gormv2.Find(h.db, q, &deadLetters)
+	if err != nil {
+		http.Error(w, "Failed to fetch dead letters", http.StatusInternalServerError)
+		log.Printf("Failed to fetch dead letters: %v", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deadLetters": deadLetters, "metadata": metadata})
+}
+
+// redrive handles POST /notifications/dead-letters/{id}/redrive. The message
+// goes back to the notification queue with a fresh set of attempts.
+func (h *deadLetterHandlers) redrive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, "/notifications/dead-letters/")
+	id, err := strconv.ParseUint(strings.TrimSuffix(rest, "/redrive"), 10, 32)
+	if err != nil || !strings.HasSuffix(rest, "/redrive") {
+		http.NotFound(w, r)
+		return
+	}
+
+	var deadLetter DeadLetter
+	if err := h.db.First(&deadLetter, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "Failed to fetch the dead letter", http.StatusInternalServerError)
+		log.Printf("Failed to fetch dead letter %d: %v", id, err)
+		return
+	}
+	// Claim the dead letter first so concurrent requests queue it only once.
+	now := time.Now()
+	result := h.db.Model(&DeadLetter{}).Where("id = ? AND redriven_at IS NULL", deadLetter.ID).Update("redriven_at", now)
+	if result.Error != nil {
+		http.Error(w, "Failed to update the dead letter", http.StatusInternalServerError)
+		log.Printf("Failed to mark dead letter %d as re-driven: %v", id, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, "The dead letter has already been re-driven", http.StatusConflict)
+		return
+	}
+
+	err = h.ch.Publish("", notificationQueue, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Body:         []byte(deadLetter.Body),
+	})
+	if err != nil {
+		h.db.Model(&DeadLetter{}).Where("id = ?", deadLetter.ID).Update("redriven_at", nil)
+		http.Error(w, "Failed to queue the notification", http.StatusServiceUnavailable)
+		log.Printf("Failed to re-drive dead letter %d: %v", id, err)
+		return
+	}
+	deadLetter.RedrivenAt = &now
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"deadLetter": deadLetter})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
+
+// requirePermission lets the request through when the authentication service
+// accepts its bearer token and the token grants permission.
+func requirePermission(authURL, permission string, next http.HandlerFunc) http.HandlerFunc {
+	client := &http.Client{Timeout: 5 * time.Second}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			http.Error(w, "Authorization header format must be Bearer {token}", http.StatusUnauthorized)
+			return
+		}
+
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, authURL+"/auth/validate-token", nil)
+		if err != nil {
+			http.Error(w, "Could not verify token", http.StatusInternalServerError)
+			return
+		}
+		req.Header.Set("Authorization", r.Header.Get("Authorization"))
+
+		resp, err := client.Do(req)
+		if err != nil {
+			http.Error(w, "Could not verify token", http.StatusServiceUnavailable)
+			log.Printf("Failed to reach the authentication service: %v", err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		var validation struct {
+			User struct {
+				Permissions []string
+			} `json:"user"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&validation); err != nil {
+			http.Error(w, "Could not verify token", http.StatusServiceUnavailable)
+			log.Printf("Failed to decode the token validation: %v", err)
+			return
+		}
+		for _, p := range validation.User.Permissions {
+			if p == permission {
+				next(w, r)
+				return
+			}
+		}
+		http.Error(w, fmt.Sprintf("Permission %q required", permission), http.StatusForbidden)
+	}
+}
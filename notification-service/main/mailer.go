@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+
+	"github.com/jordan-wright/email"
+)
+
+// SMTPTransport sends mail through an SMTP server. Without a password it
+// does not authenticate, which is what local stand-ins like MailHog expect.
+type SMTPTransport struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// smtpTransportFromEnv reads the transport settings from SMTP_HOST,
+// SMTP_PORT, SMTP_USERNAME, SMTP_MAIL and SMTP_KEY. The username defaults to
+// the sender address.
+func smtpTransportFromEnv() *SMTPTransport {
+	t := &SMTPTransport{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_KEY"),
+		From:     os.Getenv("SMTP_MAIL"),
+	}
+	if t.Host == "" {
+		t.Host = "smtp.gmail.com"
+	}
+	if t.Port == "" {
+		t.Port = "587"
+	}
+	if t.Username == "" {
+		t.Username = t.From
+	}
+	return t
+}
+
+// SendEmail sends msg, with an HTML alternative when it has one.
+func (t *SMTPTransport) SendEmail(to string, msg *Message) error {
+	e := email.NewEmail()
+	e.From = t.From
+	e.To = []string{to}
+	e.Subject = msg.Subject
+	e.Text = []byte(msg.Text)
+	if msg.HTML != "" {
+		e.HTML = []byte(msg.HTML)
+	}
+
+	var auth smtp.Auth
+	if t.Password != "" {
+		auth = smtp.PlainAuth("", t.Username, t.Password, t.Host)
+	}
+	if err := e.Send(t.Host+":"+t.Port, auth); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", to, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer accepts one message and sends its DATA section to received.
+func fakeSMTPServer(t *testing.T) (addr string, received <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					messages <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				inData = true
+				reply("354 End data with <CR><LF>.<CR><LF>")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return ln.Addr().String(), messages
+}
+
+func TestSMTPTransportSendEmail(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	transport := &SMTPTransport{Host: host, Port: port, From: "lms@example.com"}
+	msg := &Message{Subject: "Enrollment", Text: "You are enrolled in Go course!", HTML: "<p>You are enrolled in <strong>Go</strong> course!</p>"}
+	if err := transport.SendEmail("student@example.com", msg); err != nil {
+		t.Fatalf("SendEmail failed: %v", err)
+	}
+
+	message := <-received
+	for _, want := range []string{"To: <student@example.com>", "Subject: Enrollment", "You are enrolled in Go course!", "Content-Type: text/html"} {
+		if !strings.Contains(message, want) {
+			t.Errorf("Expected the message to contain %q; got:\n%s", want, message)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"lms-shared/events"
+)
+
+// notificationSubject is the subject of messages queued before events were
+// introduced, which carry finished text.
+const notificationSubject = "LMS notification"
+
+// errInvalidNotification marks messages that can never be delivered, so they
+// are dead-lettered without being retried.
+var errInvalidNotification = errors.New("invalid notification")
+
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time  `json:"createdAt"`
+	EventID   string     `gorm:"index" json:"eventId,omitempty"`
+	EventType string     `json:"eventType,omitempty"`
+	Locale    string     `json:"locale,omitempty"`
+	MessageTo string     `json:"messageTo"`
+	Subject   string     `json:"subject"`
+	Content   string     `json:"content"`
+	SentAt    *time.Time `json:"sentAt"`
+}
+
+// legacyMessage is the format of messages queued before events were
+// introduced.
+type legacyMessage struct {
+	MessageTo string `json:"messageTo"`
+	Content   string `json:"content"`
+}
+
+type mailer interface {
+	SendEmail(to string, msg *Message) error
+}
+
+// prepareNotification turns a queued message into the email to send, in the
+// recipient's language when there is a template for it.
+func prepareNotification(templates *templateRegistry, body []byte) (*Notification, *Message, error) {
+	var probe struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errInvalidNotification, err)
+	}
+
+	if probe.Type == "" {
+		var legacy legacyMessage
+		if err := json.Unmarshal(body, &legacy); err != nil || legacy.MessageTo == "" {
+			return nil, nil, fmt.Errorf("%w: neither an event nor a message with messageTo", errInvalidNotification)
+		}
+		msg := &Message{Subject: notificationSubject, Text: legacy.Content}
+		return &Notification{MessageTo: legacy.MessageTo, Subject: msg.Subject, Content: msg.Text}, msg, nil
+	}
+
+	envelope, event, err := events.Decode(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errInvalidNotification, err)
+	}
+	if envelope.Recipient == "" {
+		return nil, nil, fmt.Errorf("%w: %s event %s has no recipient", errInvalidNotification, envelope.Type, envelope.ID)
+	}
+	msg, locale, err := templates.render(envelope.Locale, event)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errInvalidNotification, err)
+	}
+	return &Notification{
+		EventID:   envelope.ID,
+		EventType: envelope.Type,
+		Locale:    locale,
+		MessageTo: envelope.Recipient,
+		Subject:   msg.Subject,
+		Content:   msg.Text,
+	}, msg, nil
+}
+
+// handleNotification sends the queued message by email and records it once
+// it was sent. Failed attempts are left to the caller to retry. Events that
+// were already sent, e.g. when a crash prevented the acknowledgement, are
+// skipped.
+func handleNotification(db *gorm.DB, m mailer, templates *templateRegistry, body []byte) error {
+	notification, msg, err := prepareNotification(templates, body)
+	if err != nil {
+		return err
+	}
+
+	if notification.EventID != "" {
+		var sent int64
+		if err := db.Model(&Notification{}).Where("event_id = ?", notification.EventID).Count(&sent).Error; err != nil {
+			return err
+		}
+		if sent > 0 {
+			log.Printf("Skipping event %s, it was already sent", notification.EventID)
+			return nil
+		}
+	}
+
+	if err := m.SendEmail(notification.MessageTo, msg); err != nil {
+		return err
+	}
+
+	// The email is out, so a failure to record it must not cause a resend.
+	now := time.Now()
+	notification.SentAt = &now
+	if err := db.Create(notification).Error; err != nil {
+		log.Printf("Failed to save the notification to %s: %v", notification.MessageTo, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"lms-shared/events"
+)
+
+func TestPrepareNotificationFromEvent(t *testing.T) {
+	templates, err := loadTemplates("../templates")
+	if err != nil {
+		t.Fatalf("Failed to load the templates: %v", err)
+	}
+	body, err := events.Marshal("student@example.com", "", events.EnrollmentCreated{CourseID: 3, CourseTitle: "Go"})
+	if err != nil {
+		t.Fatalf("Failed to marshal the event: %v", err)
+	}
+
+	notification, msg, err := prepareNotification(templates, body)
+	if err != nil {
+		t.Fatalf("prepareNotification failed: %v", err)
+	}
+	if notification.EventID == "" || notification.EventType != "enrollment.created" || notification.Locale != "en" {
+		t.Errorf("Expected the event ID and type to be kept; got %+v", notification)
+	}
+	if notification.MessageTo != "student@example.com" || notification.Content != "You are enrolled in Go course!" {
+		t.Errorf("Unexpected notification %+v", notification)
+	}
+	if msg.HTML == "" {
+		t.Error("Expected an HTML variant")
+	}
+}
+
+func TestPrepareNotificationFromLegacyMessage(t *testing.T) {
+	notification, _, err := prepareNotification(nil, []byte(`{"messageTo": "student@example.com", "content": "Hello"}`))
+	if err != nil {
+		t.Fatalf("prepareNotification failed: %v", err)
+	}
+	if notification.MessageTo != "student@example.com" || notification.Subject != notificationSubject || notification.Content != "Hello" {
+		t.Errorf("Unexpected notification %+v", notification)
+	}
+}
+
+func TestPrepareNotificationRejectsUnknownEvents(t *testing.T) {
+	body := []byte(`{"id": "1", "type": "course.exploded", "version": 1, "recipient": "student@example.com", "payload": {}}`)
+	if _, _, err := prepareNotification(nil, body); !errors.Is(err, errInvalidNotification) {
+		t.Errorf("Expected errInvalidNotification; got %v", err)
+	}
+}
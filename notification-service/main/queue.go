@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/streadway/amqp"
+	"gorm.io/gorm"
+)
+
+const (
+	notificationQueue = "notification_queue"
+	deadLetterQueue   = "notification_queue.dead"
+
+	// maxAttempts is how many times a notification is tried before it is
+	// dead-lettered. Attempt n+1 waits retryBaseDelay*2^(n-1) in a delay queue.
+	maxAttempts    = 5
+	retryBaseDelay = 10 * time.Second
+
+	attemptHeader   = "x-attempt"
+	lastErrorHeader = "x-last-error"
+)
+
+// retryQueue names the delay queue used before attempt+1.
+func retryQueue(attempt int) string {
+	return fmt.Sprintf("%s.retry.%d", notificationQueue, attempt)
+}
+
+// retryDelay is how long a message waits after its attempt-th failure.
+func retryDelay(attempt int) time.Duration {
+	return retryBaseDelay << (attempt - 1)
+}
+
+// declareQueues declares the durable notification queue, one delay queue per
+// retry and the dead-letter queue. Delay queues have no consumers: messages
+// expire after the delay and RabbitMQ routes them back to the main queue.
+func declareQueues(ch *amqp.Channel) error {
+	if _, err := ch.QueueDeclare(notificationQueue, true, false, false, false, nil); err != nil {
+		return err
+	}
+	for attempt := 1; attempt < maxAttempts; attempt++ {
+		_, err := ch.QueueDeclare(retryQueue(attempt), true, false, false, false, amqp.Table{
+			"x-message-ttl":             int64(retryDelay(attempt) / time.Millisecond),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": notificationQueue,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := ch.QueueDeclare(deadLetterQueue, true, false, false, false, nil)
+	return err
+}
+
+// attemptOf returns how many times the delivery was already tried.
+func attemptOf(d amqp.Delivery) int {
+	switch n := d.Headers[attemptHeader].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	}
+	return 0
+}
+
+// consumer sends queued notifications and acknowledges them only once they
+// were delivered, retried or dead-lettered, so a crash never loses a message.
+type consumer struct {
+	ch        *amqp.Channel
+	db        *gorm.DB
+	mailer    mailer
+	templates *templateRegistry
+}
+
+func (c *consumer) handle(d amqp.Delivery) {
+	err := handleNotification(c.db, c.mailer, c.templates, d.Body)
+	if err == nil {
+		d.Ack(false)
+		return
+	}
+
+	attempt := attemptOf(d) + 1
+	queue := deadLetterQueue
+	if attempt < maxAttempts && !errors.Is(err, errInvalidNotification) {
+		queue = retryQueue(attempt)
+		log.Printf("Attempt %d to deliver the notification failed, retrying in %s: %v", attempt, retryDelay(attempt), err)
+	} else {
+		log.Printf("Giving up on the notification after %d attempts: %v", attempt, err)
+	}
+
+	if err := c.forward(queue, d.Body, attempt, err); err != nil {
+		// Keep the message in the queue rather than losing it.
+		log.Printf("Failed to move the notification to %s: %v", queue, err)
+		d.Nack(false, true)
+		return
+	}
+	d.Ack(false)
+}
+
+func (c *consumer) forward(queue string, body []byte, attempt int, cause error) error {
+	return c.ch.Publish("", queue, false, false, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Headers: amqp.Table{
+			attemptHeader:   int32(attempt),
+			lastErrorHeader: cause.Error(),
+		},
+		Body: body,
+	})
+}
+
+// describeNotification names a queued message for the log without its
+// payload, which may carry tokens and links.
+func describeNotification(body []byte) string {
+	var head struct {
+		ID        string `json:"id"`
+		Type      string `json:"type"`
+		Recipient string `json:"recipient"`
+		MessageTo string `json:"messageTo"`
+	}
+	switch {
+	case json.Unmarshal(body, &head) != nil:
+		return "malformed message"
+	case head.Type != "":
+		return fmt.Sprintf("%s event %s to %s", head.Type, head.ID, head.Recipient)
+	default:
+		return "message to " + head.MessageTo
+	}
+}
+
+// consumeNotifications handles notifications until the channel is closed.
+func consumeNotifications(ch *amqp.Channel, db *gorm.DB, m mailer, templates *templateRegistry) error {
+	msgs, err := ch.Consume(notificationQueue, "", false, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	c := &consumer{ch: ch, db: db, mailer: m, templates: templates}
+	for d := range msgs {
+		log.Printf("Received a notification: %s", describeNotification(d.Body))
+		c.handle(d)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestRetryDelayDoubles(t *testing.T) {
+	want := []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second}
+	for attempt := 1; attempt < maxAttempts; attempt++ {
+		if got := retryDelay(attempt); got != want[attempt-1] {
+			t.Errorf("retryDelay(%d) = %s; want %s", attempt, got, want[attempt-1])
+		}
+	}
+}
+
+func TestAttemptOf(t *testing.T) {
+	tests := []struct {
+		headers amqp.Table
+		want    int
+	}{
+		{nil, 0},
+		{amqp.Table{attemptHeader: int32(2)}, 2},
+		{amqp.Table{attemptHeader: int64(3)}, 3},
+		{amqp.Table{attemptHeader: "4"}, 0},
+	}
+	for _, tt := range tests {
+		if got := attemptOf(amqp.Delivery{Headers: tt.headers}); got != tt.want {
+			t.Errorf("attemptOf(%v) = %d; want %d", tt.headers, got, tt.want)
+		}
+	}
+}
+
+func TestMalformedNotificationsAreNotRetried(t *testing.T) {
+	for _, body := range []string{`not json`, `{"content": "no recipient"}`} {
+		err := handleNotification(nil, nil, nil, []byte(body))
+		if !errors.Is(err, errInvalidNotification) {
+			t.Errorf("handleNotification(%q) = %v; want errInvalidNotification", body, err)
+		}
+	}
+}
+
+func TestDescribeNotificationLeavesOutThePayload(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"id": "e1", "type": "user.activation_link_requested", "recipient": "a@example.com", "payload": {"token": "secret"}}`, "user.activation_link_requested event e1 to a@example.com"},
+		{`{"messageTo": "b@example.com", "content": "secret link"}`, "message to b@example.com"},
+		{`not json`, "malformed message"},
+	}
+	for _, tt := range tests {
+		if got := describeNotification([]byte(tt.body)); got != tt.want {
+			t.Errorf("describeNotification(%q) = %q; want %q", tt.body, got, tt.want)
+		}
+	}
+}
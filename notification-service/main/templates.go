@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"lms-shared/events"
+)
+
+// fallbackLocales are tried, in order, when there is no template in the
+// recipient's language.
+var fallbackLocales = []string{"en", "ru"}
+
+var errNoTemplate = errors.New("no template")
+
+// Message is a rendered email.
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// localizedTemplate renders one event type in one locale. The text template
+// defines the subject in a "subject" block; html is nil when the event only
+// has a plain-text variant.
+type localizedTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// templateRegistry holds the email templates by locale and event type. They
+// are loaded from <dir>/<locale>/<event type>.txt and .html, and the HTML
+// variants are rendered inside <dir>/layout.html.
+type templateRegistry struct {
+	templates map[string]map[string]*localizedTemplate
+}
+
+func loadTemplates(dir string) (*templateRegistry, error) {
+	layoutSource, err := os.ReadFile(filepath.Join(dir, "layout.html"))
+	if err != nil {
+		return nil, err
+	}
+	layout, err := htmltemplate.New("layout").Parse(string(layoutSource))
+	if err != nil {
+		return nil, fmt.Errorf("layout.html: %w", err)
+	}
+
+	localeDirs, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &templateRegistry{templates: make(map[string]map[string]*localizedTemplate)}
+	for _, localeDir := range localeDirs {
+		if !localeDir.IsDir() {
+			continue
+		}
+		locale := localeDir.Name()
+		files, err := filepath.Glob(filepath.Join(dir, locale, "*.txt"))
+		if err != nil {
+			return nil, err
+		}
+
+		r.templates[locale] = make(map[string]*localizedTemplate)
+		for _, file := range files {
+			eventType := strings.TrimSuffix(filepath.Base(file), ".txt")
+			t := &localizedTemplate{}
+			if t.text, err = texttemplate.ParseFiles(file); err != nil {
+				return nil, err
+			}
+			if t.text.Lookup("subject") == nil {
+				return nil, fmt.Errorf("%s: no subject block", file)
+			}
+
+			htmlFile := strings.TrimSuffix(file, ".txt") + ".html"
+			if _, err := os.Stat(htmlFile); err == nil {
+				if t.html, err = htmltemplate.Must(layout.Clone()).ParseFiles(htmlFile); err != nil {
+					return nil, err
+				}
+			}
+			r.templates[locale][eventType] = t
+		}
+	}
+	return r, nil
+}
+
+// candidateLocales lists the locales to try for a language tag such as
+// "ru-ru": the tag itself, its language and then the fallbacks.
+func candidateLocales(locale string) []string {
+	locale = strings.ToLower(locale)
+	candidates := make([]string, 0, len(fallbackLocales)+2)
+	if locale != "" {
+		candidates = append(candidates, locale)
+		if language, _, found := strings.Cut(locale, "-"); found {
+			candidates = append(candidates, language)
+		}
+	}
+	return append(candidates, fallbackLocales...)
+}
+
+// render picks the template of the event type in the closest locale and
+// renders it. It returns the locale that was used.
+func (r *templateRegistry) render(locale string, event events.Event) (*Message, string, error) {
+	for _, candidate := range candidateLocales(locale) {
+		t, ok := r.templates[candidate][event.Type()]
+		if !ok {
+			continue
+		}
+
+		var subject, text bytes.Buffer
+		if err := t.text.ExecuteTemplate(&subject, "subject", event); err != nil {
+			return nil, "", err
+		}
+		if err := t.text.Execute(&text, event); err != nil {
+			return nil, "", err
+		}
+		msg := &Message{Subject: strings.TrimSpace(subject.String()), Text: strings.TrimSpace(text.String())}
+
+		if t.html != nil {
+			var html bytes.Buffer
+			if err := t.html.ExecuteTemplate(&html, "layout", event); err != nil {
+				return nil, "", err
+			}
+			msg.HTML = html.String()
+		}
+		return msg, candidate, nil
+	}
+	return nil, "", fmt.Errorf("%w for %s events", errNoTemplate, event.Type())
+}
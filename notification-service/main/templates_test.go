@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"lms-shared/events"
+)
+
+func TestEveryEventHasTemplates(t *testing.T) {
+	templates, err := loadTemplates("../templates")
+	if err != nil {
+		t.Fatalf("Failed to load the templates: %v", err)
+	}
+
+	for _, locale := range fallbackLocales {
+		for _, eventType := range events.Types() {
+			tmpl, ok := templates.templates[locale][eventType]
+			if !ok {
+				t.Errorf("No %s template for %s events", locale, eventType)
+				continue
+			}
+			if tmpl.html == nil {
+				t.Errorf("No %s HTML template for %s events", locale, eventType)
+			}
+		}
+	}
+}
+
+func TestRenderPicksLocale(t *testing.T) {
+	templates, err := loadTemplates("../templates")
+	if err != nil {
+		t.Fatalf("Failed to load the templates: %v", err)
+	}
+	event := &events.CoursePublished{CourseID: 1, Title: "Go <basics>"}
+
+	tests := []struct {
+		locale     string
+		wantLocale string
+		wantText   string
+	}{
+		{"ru", "ru", "Курс Go <basics> опубликован!"},
+		{"ru-RU", "ru", "Курс Go <basics> опубликован!"},
+		{"en", "en", "The Go <basics> course is published!"},
+		{"", "en", "The Go <basics> course is published!"},
+		{"de", "en", "The Go <basics> course is published!"},
+	}
+	for _, tt := range tests {
+		msg, locale, err := templates.render(tt.locale, event)
+		if err != nil {
+			t.Fatalf("render(%q) failed: %v", tt.locale, err)
+		}
+		if locale != tt.wantLocale || msg.Text != tt.wantText {
+			t.Errorf("render(%q) = %q in %q; want %q in %q", tt.locale, msg.Text, locale, tt.wantText, tt.wantLocale)
+		}
+		if msg.Subject == "" {
+			t.Errorf("render(%q) has no subject", tt.locale)
+		}
+		if !strings.Contains(msg.HTML, "Go &lt;basics&gt;") {
+			t.Errorf("Expected the HTML variant to escape the title; got %s", msg.HTML)
+		}
+	}
+}
+
+func TestCandidateLocales(t *testing.T) {
+	got := strings.Join(candidateLocales("pt-BR"), ",")
+	if want := "pt-br,pt,en,ru"; got != want {
+		t.Errorf("candidateLocales(pt-BR) = %s; want %s", got, want)
+	}
+}
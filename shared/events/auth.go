@@ -0,0 +1,109 @@
+package events
+
+// Events published by the authentication service. Each is addressed to the
+// account owner.
+
+func init() {
+	register(func() Event { return &UserRegistered{} })
+	register(func() Event { return &ActivationLinkRequested{} })
+	register(func() Event { return &UserActivated{} })
+	register(func() Event { return &UserLoggedIn{} })
+	register(func() Event { return &AccountLocked{} })
+	register(func() Event { return &PasswordResetRequested{} })
+	register(func() Event { return &PasswordChanged{} })
+	register(func() Event { return &EmailConfirmationRequested{} })
+	register(func() Event { return &EmailChangeRequested{} })
+	register(func() Event { return &EmailChanged{} })
+	register(func() Event { return &TwoFactorEnabled{} })
+	register(func() Event { return &TwoFactorDisabled{} })
+}
+
+// UserRegistered is published when an account is created and needs
+// activation.
+type UserRegistered struct {
+	ActivationLink string `json:"activationLink"`
+}
+
+func (UserRegistered) Type() string { return "user.registered" }
+func (UserRegistered) Version() int { return 1 }
+
+// ActivationLinkRequested is published when a user asks for the activation
+// link again.
+type ActivationLinkRequested struct {
+	ActivationLink string `json:"activationLink"`
+}
+
+func (ActivationLinkRequested) Type() string { return "user.activation_link_requested" }
+func (ActivationLinkRequested) Version() int { return 1 }
+
+// UserActivated is published once an account was activated.
+type UserActivated struct{}
+
+func (UserActivated) Type() string { return "user.activated" }
+func (UserActivated) Version() int { return 1 }
+
+// UserLoggedIn is published after every successful login.
+type UserLoggedIn struct{}
+
+func (UserLoggedIn) Type() string { return "user.logged_in" }
+func (UserLoggedIn) Version() int { return 1 }
+
+// AccountLocked is published when repeated failed logins lock an account.
+type AccountLocked struct{}
+
+func (AccountLocked) Type() string { return "user.locked" }
+func (AccountLocked) Version() int { return 1 }
+
+// PasswordResetRequested carries the token that lets the user choose a new
+// password.
+type PasswordResetRequested struct {
+	ResetToken string `json:"resetToken"`
+}
+
+func (PasswordResetRequested) Type() string { return "user.password_reset_requested" }
+func (PasswordResetRequested) Version() int { return 1 }
+
+// PasswordChanged is published after a password change or reset.
+type PasswordChanged struct{}
+
+func (PasswordChanged) Type() string { return "user.password_changed" }
+func (PasswordChanged) Version() int { return 1 }
+
+// EmailConfirmationRequested is sent to the new address of an email change
+// with the token that confirms it.
+type EmailConfirmationRequested struct {
+	ConfirmToken string `json:"confirmToken"`
+}
+
+func (EmailConfirmationRequested) Type() string { return "user.email_confirmation_requested" }
+func (EmailConfirmationRequested) Version() int { return 1 }
+
+// EmailChangeRequested warns the current address that a change to NewEmail
+// was requested.
+type EmailChangeRequested struct {
+	NewEmail string `json:"newEmail"`
+}
+
+func (EmailChangeRequested) Type() string { return "user.email_change_requested" }
+func (EmailChangeRequested) Version() int { return 1 }
+
+// EmailChanged tells the old address that the account now uses NewEmail.
+type EmailChanged struct {
+	NewEmail string `json:"newEmail"`
+}
+
+func (EmailChanged) Type() string { return "user.email_changed" }
+func (EmailChanged) Version() int { return 1 }
+
+// TwoFactorEnabled is published when two-factor authentication is turned on.
+type TwoFactorEnabled struct{}
+
+func (TwoFactorEnabled) Type() string { return "user.two_factor_enabled" }
+func (TwoFactorEnabled) Version() int { return 1 }
+
+// TwoFactorDisabled is published when two-factor authentication is turned
+// off.
+type TwoFactorDisabled struct{}
+
+func (TwoFactorDisabled) Type() string { return "user.two_factor_disabled" }
+func (TwoFactorDisabled) Version() int { return 1 }
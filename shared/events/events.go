@@ -0,0 +1,114 @@
+// Package events defines the messages the services publish to the
+// notification queue. Every message is an Envelope around one typed payload;
+// consumers decide how to present it.
+package events
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrUnknownType is returned for envelopes whose type is not registered.
+	ErrUnknownType = errors.New("unknown event type")
+	// ErrUnsupportedVersion is returned for payloads newer than this package.
+	ErrUnsupportedVersion = errors.New("unsupported event version")
+)
+
+// Event is a payload. Version is bumped whenever a field changes meaning or
+// is removed; adding a field does not need a new version.
+type Event interface {
+	Type() string
+	Version() int
+}
+
+// Envelope is what goes over the wire. Recipient is the address of the person
+// to notify about the event and Locale their preferred language, if known.
+type Envelope struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Recipient  string          `json:"recipient"`
+	Locale     string          `json:"locale,omitempty"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// registry maps event types to constructors of their payloads.
+var registry = map[string]func() Event{}
+
+func register(newEvent func() Event) {
+	registry[newEvent().Type()] = newEvent
+}
+
+// New wraps event in an envelope with a fresh ID and the current time.
+func New(recipient, locale string, event Event) (*Envelope, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		ID:         newID(),
+		Type:       event.Type(),
+		Version:    event.Version(),
+		OccurredAt: time.Now().UTC(),
+		Recipient:  recipient,
+		Locale:     locale,
+		Payload:    payload,
+	}, nil
+}
+
+// Marshal is New followed by encoding the envelope as JSON.
+func Marshal(recipient, locale string, event Event) ([]byte, error) {
+	envelope, err := New(recipient, locale, event)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope)
+}
+
+// Types lists the registered event types.
+func Types() []string {
+	types := make([]string, 0, len(registry))
+	for t := range registry {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Decode parses an envelope and its payload.
+func Decode(body []byte) (*Envelope, Event, error) {
+	var envelope Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, nil, err
+	}
+
+	newEvent, ok := registry[envelope.Type]
+	if !ok {
+		return &envelope, nil, fmt.Errorf("%w: %q", ErrUnknownType, envelope.Type)
+	}
+	event := newEvent()
+	if envelope.Version > event.Version() {
+		return &envelope, nil, fmt.Errorf("%w: %s v%d", ErrUnsupportedVersion, envelope.Type, envelope.Version)
+	}
+	if err := json.Unmarshal(envelope.Payload, event); err != nil {
+		return &envelope, nil, fmt.Errorf("invalid %s payload: %w", envelope.Type, err)
+	}
+	return &envelope, event, nil
+}
+
+// newID returns a random UUID in its canonical text form.
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("events: failed to read random bytes: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,64 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestMarshalAndDecode(t *testing.T) {
+	body, err := Marshal("student@example.com", "ru", CoursePublished{CourseID: 7, Title: "Go"})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	envelope, event, err := Decode(body)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(envelope.ID) {
+		t.Errorf("Expected a UUID as the event ID; got %q", envelope.ID)
+	}
+	if envelope.Type != "course.published" || envelope.Version != 1 || envelope.Recipient != "student@example.com" || envelope.Locale != "ru" {
+		t.Errorf("Unexpected envelope %+v", envelope)
+	}
+	if envelope.OccurredAt.IsZero() {
+		t.Error("Expected OccurredAt to be set")
+	}
+
+	published, ok := event.(*CoursePublished)
+	if !ok {
+		t.Fatalf("Expected *CoursePublished; got %T", event)
+	}
+	if published.CourseID != 7 || published.Title != "Go" {
+		t.Errorf("Unexpected payload %+v", published)
+	}
+}
+
+func TestDecodeRejectsUnknownEvents(t *testing.T) {
+	tests := []struct {
+		envelope Envelope
+		want     error
+	}{
+		{Envelope{Type: "course.exploded", Version: 1, Payload: json.RawMessage(`{}`)}, ErrUnknownType},
+		{Envelope{Type: "course.published", Version: 2, Payload: json.RawMessage(`{}`)}, ErrUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		body, _ := json.Marshal(tt.envelope)
+		if _, _, err := Decode(body); !errors.Is(err, tt.want) {
+			t.Errorf("Decode(%s) = %v; want %v", body, err, tt.want)
+		}
+	}
+}
+
+func TestEventIDsAreUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := newID()
+		if seen[id] {
+			t.Fatalf("Duplicate event ID %s", id)
+		}
+		seen[id] = true
+	}
+}
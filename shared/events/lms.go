@@ -0,0 +1,142 @@
+package events
+
+// Events published by the LMS service.
+
+func init() {
+	register(func() Event { return &CourseCreated{} })
+	register(func() Event { return &CourseUpdated{} })
+	register(func() Event { return &CoursePublished{} })
+	register(func() Event { return &CourseCompleted{} })
+	register(func() Event { return &ModuleCreated{} })
+	register(func() Event { return &ModuleUpdated{} })
+	register(func() Event { return &LessonCreated{} })
+	register(func() Event { return &LessonUpdated{} })
+	register(func() Event { return &EnrollmentCreated{} })
+	register(func() Event { return &EnrollmentCancelled{} })
+	register(func() Event { return &QuizAttemptScored{} })
+	register(func() Event { return &SubmissionGraded{} })
+}
+
+// CourseCreated is published when an instructor creates a course.
+type CourseCreated struct {
+	CourseID uint   `json:"courseId"`
+	Title    string `json:"title"`
+}
+
+func (CourseCreated) Type() string { return "course.created" }
+func (CourseCreated) Version() int { return 1 }
+
+// CourseUpdated is published when the settings of a course change.
+type CourseUpdated struct {
+	CourseID uint   `json:"courseId"`
+	Title    string `json:"title"`
+}
+
+func (CourseUpdated) Type() string { return "course.updated" }
+func (CourseUpdated) Version() int { return 1 }
+
+// CoursePublished is published when a course becomes visible to students.
+type CoursePublished struct {
+	CourseID uint   `json:"courseId"`
+	Title    string `json:"title"`
+}
+
+func (CoursePublished) Type() string { return "course.published" }
+func (CoursePublished) Version() int { return 1 }
+
+// CourseCompleted is published when a student completes the last lesson of a
+// course.
+type CourseCompleted struct {
+	CourseID    uint   `json:"courseId"`
+	CourseTitle string `json:"courseTitle"`
+}
+
+func (CourseCompleted) Type() string { return "course.completed" }
+func (CourseCompleted) Version() int { return 1 }
+
+// ModuleCreated is published when a module is added to a course.
+type ModuleCreated struct {
+	ModuleID    uint   `json:"moduleId"`
+	Title       string `json:"title"`
+	CourseID    uint   `json:"courseId"`
+	CourseTitle string `json:"courseTitle"`
+}
+
+func (ModuleCreated) Type() string { return "module.created" }
+func (ModuleCreated) Version() int { return 1 }
+
+// ModuleUpdated is published when a module is renamed.
+type ModuleUpdated struct {
+	ModuleID    uint   `json:"moduleId"`
+	Title       string `json:"title"`
+	CourseID    uint   `json:"courseId"`
+	CourseTitle string `json:"courseTitle"`
+}
+
+func (ModuleUpdated) Type() string { return "module.updated" }
+func (ModuleUpdated) Version() int { return 1 }
+
+// LessonCreated is published when a lesson is added to a module.
+type LessonCreated struct {
+	LessonID    uint   `json:"lessonId"`
+	Title       string `json:"title"`
+	ModuleID    uint   `json:"moduleId"`
+	ModuleTitle string `json:"moduleTitle"`
+	CourseTitle string `json:"courseTitle"`
+}
+
+func (LessonCreated) Type() string { return "lesson.created" }
+func (LessonCreated) Version() int { return 1 }
+
+// LessonUpdated is published when a lesson changes.
+type LessonUpdated struct {
+	LessonID    uint   `json:"lessonId"`
+	Title       string `json:"title"`
+	ModuleID    uint   `json:"moduleId"`
+	ModuleTitle string `json:"moduleTitle"`
+	CourseTitle string `json:"courseTitle"`
+}
+
+func (LessonUpdated) Type() string { return "lesson.updated" }
+func (LessonUpdated) Version() int { return 1 }
+
+// EnrollmentCreated is published when a student enrolls in a course.
+type EnrollmentCreated struct {
+	CourseID    uint   `json:"courseId"`
+	CourseTitle string `json:"courseTitle"`
+}
+
+func (EnrollmentCreated) Type() string { return "enrollment.created" }
+func (EnrollmentCreated) Version() int { return 1 }
+
+// EnrollmentCancelled is published when a student leaves a course.
+type EnrollmentCancelled struct {
+	CourseID    uint   `json:"courseId"`
+	CourseTitle string `json:"courseTitle"`
+}
+
+func (EnrollmentCancelled) Type() string { return "enrollment.cancelled" }
+func (EnrollmentCancelled) Version() int { return 1 }
+
+// QuizAttemptScored is published when a quiz attempt is submitted and scored.
+type QuizAttemptScored struct {
+	QuizID    uint    `json:"quizId"`
+	QuizTitle string  `json:"quizTitle"`
+	Score     float64 `json:"score"`
+	MaxScore  float64 `json:"maxScore"`
+}
+
+func (QuizAttemptScored) Type() string { return "quiz.attempt_scored" }
+func (QuizAttemptScored) Version() int { return 1 }
+
+// SubmissionGraded is published when an instructor grades an assignment
+// submission.
+type SubmissionGraded struct {
+	AssignmentID    uint    `json:"assignmentId"`
+	AssignmentTitle string  `json:"assignmentTitle"`
+	Grade           float64 `json:"grade"`
+	MaxPoints       float64 `json:"maxPoints"`
+}
+
+func (SubmissionGraded) Type() string { return "submission.graded" }
+func (SubmissionGraded) Version() int { return 1 }
@@ -0,0 +1,13 @@
+module lms-shared
+
+go 1.21
+
+require (
+	github.com/jinzhu/gorm v1.9.16
+	gorm.io/gorm v1.25.9
+)
+
+require (
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+)
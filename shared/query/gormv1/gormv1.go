@@ -0,0 +1,29 @@
+// Package gormv1 applies a query.Query with github.com/jinzhu/gorm.
+package gormv1
+
+import (
+	"github.com/jinzhu/gorm"
+	"lms-shared/query"
+)
+
+// Find loads one page into dest, a pointer to a slice, and counts the rows
+// matching the filters.
+func Find(db *gorm.DB, q *query.Query, dest interface{}) (query.Metadata, error) {
+	for _, condition := range q.Conditions {
+		db = db.Where(condition.SQL, condition.Args...)
+	}
+
+	var total int64
+	if err := db.Model(dest).Count(&total).Error; err != nil {
+		return query.Metadata{}, err
+	}
+
+	if condition := q.CursorCondition(); condition != nil {
+		db = db.Where(condition.SQL, condition.Args...)
+	}
+	err := db.Order(q.OrderBy()).Offset(q.Offset()).Limit(q.Limit + 1).Find(dest).Error
+	if err != nil {
+		return query.Metadata{}, err
+	}
+	return q.Finish(dest, total), nil
+}
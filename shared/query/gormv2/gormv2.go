@@ -0,0 +1,29 @@
+// Package gormv2 applies a query.Query with gorm.io/gorm.
+package gormv2
+
+import (
+	"gorm.io/gorm"
+	"lms-shared/query"
+)
+
+// Find loads one page into dest, a pointer to a slice, and counts the rows
+// matching the filters.
+func Find(db *gorm.DB, q *query.Query, dest interface{}) (query.Metadata, error) {
+	for _, condition := range q.Conditions {
+		db = db.Where(condition.SQL, condition.Args...)
+	}
+
+	var total int64
+	if err := db.Session(&gorm.Session{}).Model(dest).Count(&total).Error; err != nil {
+		return query.Metadata{}, err
+	}
+
+	if condition := q.CursorCondition(); condition != nil {
+		db = db.Where(condition.SQL, condition.Args...)
+	}
+	err := db.Order(q.OrderBy()).Offset(q.Offset()).Limit(q.Limit + 1).Find(dest).Error
+	if err != nil {
+		return query.Metadata{}, err
+	}
+	return q.Finish(dest, total), nil
+}
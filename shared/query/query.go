@@ -0,0 +1,326 @@
+// Package query turns list request parameters into pagination, sorting and
+// filtering that the services apply to their database queries. It does not
+// depend on an HTTP framework or on a gorm version; see the gormv1 and
+// gormv2 packages for applying a Query.
+//
+// The parameters are
+//
+//	page, limit       offset pagination, page starts at 1
+//	cursor            keyset pagination, the next_cursor of the previous page
+//	sort              comma separated fields, a leading - sorts descending
+//	<filter>          any filter declared in the Spec, e.g. title=go
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is returned for invalid list parameters. Its message can be shown to
+// the client.
+type Error struct {
+	msg string
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+func errorf(format string, args ...interface{}) error {
+	return &Error{msg: fmt.Sprintf(format, args...)}
+}
+
+// IsInvalid reports whether err is about invalid list parameters.
+func IsInvalid(err error) bool {
+	var e *Error
+	return errors.As(err, &e)
+}
+
+// SortField is a field clients may sort by. Field names the struct field
+// holding the value, it is needed to build cursors.
+type SortField struct {
+	Column string
+	Field  string
+}
+
+// Filter turns a parameter value into a condition.
+type Filter func(value string) (Condition, error)
+
+// Condition is an SQL condition with its arguments.
+type Condition struct {
+	SQL  string
+	Args []interface{}
+}
+
+// Contains matches rows whose column contains the value, ignoring case.
+func Contains(column string) Filter {
+	return func(value string) (Condition, error) {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value) + "%"
+		return Condition{SQL: column + " ILIKE ?", Args: []interface{}{pattern}}, nil
+	}
+}
+
+// Equals matches rows whose column equals the value.
+func Equals(column string) Filter {
+	return func(value string) (Condition, error) {
+		return Condition{SQL: column + " = ?", Args: []interface{}{value}}, nil
+	}
+}
+
+// Bool matches rows whose boolean column equals the value.
+func Bool(column string) Filter {
+	return func(value string) (Condition, error) {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return Condition{}, errorf("%q is not a boolean", value)
+		}
+		return Condition{SQL: column + " = ?", Args: []interface{}{b}}, nil
+	}
+}
+
+// After matches rows whose time column is after the value, given as RFC 3339
+// or as a date.
+func After(column string) Filter {
+	return timeFilter(column, ">")
+}
+
+// Before matches rows whose time column is before the value.
+func Before(column string) Filter {
+	return timeFilter(column, "<")
+}
+
+func timeFilter(column, op string) Filter {
+	return func(value string) (Condition, error) {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t, err = time.Parse("2006-01-02", value)
+		}
+		if err != nil {
+			return Condition{}, errorf("%q is not a time, use RFC 3339 or YYYY-MM-DD", value)
+		}
+		return Condition{SQL: column + " " + op + " ?", Args: []interface{}{t}}, nil
+	}
+}
+
+// Spec declares what a list endpoint supports.
+type Spec struct {
+	// Sort lists the sortable fields by parameter name.
+	Sort map[string]SortField
+	// DefaultSort is used without a sort parameter, e.g. "-created_at".
+	DefaultSort string
+	// Filters lists the filters by parameter name.
+	Filters map[string]Filter
+	// IDColumn and IDField break ties between equal sort values. They
+	// default to "id" and "ID".
+	IDColumn string
+	IDField  string
+	// DefaultLimit and MaxLimit default to 20 and 100.
+	DefaultLimit int
+	MaxLimit     int
+}
+
+type order struct {
+	SortField
+	Desc bool
+}
+
+// Query is a parsed list request.
+type Query struct {
+	Page       int
+	Limit      int
+	Conditions []Condition
+
+	order    []order
+	cursor   *cursor
+	idColumn string
+	idField  string
+}
+
+type cursor struct {
+	Value interface{} `json:"v"`
+	ID    uint        `json:"id"`
+}
+
+// Metadata describes the page returned to the client.
+type Metadata struct {
+	Page         int    `json:"page,omitempty"`
+	Limit        int    `json:"limit"`
+	TotalRecords int64  `json:"total_records"`
+	TotalPages   int64  `json:"total_pages"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+}
+
+// Parse reads the list parameters in values according to spec.
+func Parse(values url.Values, spec Spec) (*Query, error) {
+	q := &Query{
+		Page:     1,
+		Limit:    spec.DefaultLimit,
+		idColumn: spec.IDColumn,
+		idField:  spec.IDField,
+	}
+	if q.Limit == 0 {
+		q.Limit = 20
+	}
+	maxLimit := spec.MaxLimit
+	if maxLimit == 0 {
+		maxLimit = 100
+	}
+	if q.idColumn == "" {
+		q.idColumn = "id"
+	}
+	if q.idField == "" {
+		q.idField = "ID"
+	}
+
+	if v := values.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return nil, errorf("page must be a positive number")
+		}
+		q.Page = page
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return nil, errorf("limit must be between 1 and %d", maxLimit)
+		}
+		q.Limit = limit
+	}
+
+	sort := values.Get("sort")
+	if sort == "" {
+		sort = spec.DefaultSort
+	}
+	for _, name := range strings.Split(sort, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		desc := strings.HasPrefix(name, "-")
+		field, ok := spec.Sort[strings.TrimPrefix(name, "-")]
+		if !ok {
+			return nil, errorf("cannot sort by %q", strings.TrimPrefix(name, "-"))
+		}
+		q.order = append(q.order, order{SortField: field, Desc: desc})
+	}
+
+	for name, filter := range spec.Filters {
+		v := values.Get(name)
+		if v == "" {
+			continue
+		}
+		condition, err := filter(v)
+		if err != nil {
+			return nil, errorf("%s: %v", name, err)
+		}
+		q.Conditions = append(q.Conditions, condition)
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		if len(q.order) > 1 {
+			return nil, errorf("cursor pagination supports a single sort field")
+		}
+		b, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil {
+			return nil, errorf("invalid cursor")
+		}
+		var c cursor
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil, errorf("invalid cursor")
+		}
+		q.cursor = &c
+		q.Page = 0
+	}
+	return q, nil
+}
+
+// Offset is the number of rows to skip, zero for cursor pagination.
+func (q *Query) Offset() int {
+	if q.cursor != nil {
+		return 0
+	}
+	return (q.Page - 1) * q.Limit
+}
+
+// OrderBy returns the ORDER BY clause. The id column always comes last so
+// the order is stable.
+func (q *Query) OrderBy() string {
+	var parts []string
+	desc := false
+	for _, o := range q.order {
+		if o.Desc {
+			parts = append(parts, o.Column+" DESC")
+		} else {
+			parts = append(parts, o.Column)
+		}
+		desc = o.Desc
+	}
+	if desc {
+		return strings.Join(append(parts, q.idColumn+" DESC"), ", ")
+	}
+	return strings.Join(append(parts, q.idColumn), ", ")
+}
+
+// CursorCondition selects the rows after the cursor, if there is one.
+func (q *Query) CursorCondition() *Condition {
+	if q.cursor == nil {
+		return nil
+	}
+	op := ">"
+	if len(q.order) == 1 && q.order[0].Desc {
+		op = "<"
+	}
+	if len(q.order) == 0 {
+		return &Condition{SQL: q.idColumn + " " + op + " ?", Args: []interface{}{q.cursor.ID}}
+	}
+	return &Condition{
+		SQL:  fmt.Sprintf("(%s, %s) %s (?, ?)", q.order[0].Column, q.idColumn, op),
+		Args: []interface{}{q.cursor.Value, q.cursor.ID},
+	}
+}
+
+// Describe returns the metadata of a page fetched with Offset and Limit.
+func (q *Query) Describe(total int64) Metadata {
+	return Metadata{
+		Page:         q.Page,
+		Limit:        q.Limit,
+		TotalRecords: total,
+		TotalPages:   (total + int64(q.Limit) - 1) / int64(q.Limit),
+	}
+}
+
+// Finish trims items, a pointer to the slice fetched with Limit+1 rows, to
+// the page and describes it. total is the number of rows matching the
+// filters.
+func (q *Query) Finish(items interface{}, total int64) Metadata {
+	meta := q.Describe(total)
+
+	slice := reflect.ValueOf(items).Elem()
+	if slice.Len() <= q.Limit {
+		return meta
+	}
+	slice.Set(slice.Slice(0, q.Limit))
+
+	// Cursors only work when the order is a single field and the id.
+	if len(q.order) > 1 {
+		return meta
+	}
+	last := reflect.Indirect(slice.Index(q.Limit - 1))
+	next := cursor{ID: uint(last.FieldByName(q.idField).Uint())}
+	if len(q.order) == 1 {
+		next.Value = last.FieldByName(q.order[0].Field).Interface()
+	}
+	b, err := json.Marshal(next)
+	if err != nil {
+		return meta
+	}
+	meta.NextCursor = base64.RawURLEncoding.EncodeToString(b)
+	return meta
+}
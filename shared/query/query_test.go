@@ -0,0 +1,89 @@
+package query
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+type item struct {
+	ID        uint
+	Title     string
+	CreatedAt time.Time
+}
+
+var testSpec = Spec{
+	Sort: map[string]SortField{
+		"title":      {Column: "title", Field: "Title"},
+		"created_at": {Column: "created_at", Field: "CreatedAt"},
+	},
+	DefaultSort: "title",
+	Filters: map[string]Filter{
+		"title":         Contains("title"),
+		"created_after": After("created_at"),
+	},
+	MaxLimit: 50,
+}
+
+func TestParse(t *testing.T) {
+	q, err := Parse(url.Values{"page": {"3"}, "limit": {"10"}, "sort": {"-created_at"}, "title": {"50%_off"}}, testSpec)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if q.Offset() != 20 {
+		t.Errorf("Expected offset 20; got %d", q.Offset())
+	}
+	if got := q.OrderBy(); got != "created_at DESC, id DESC" {
+		t.Errorf("Unexpected order: %s", got)
+	}
+	if len(q.Conditions) != 1 || q.Conditions[0].Args[0] != `%50\%\_off%` {
+		t.Errorf("Unexpected conditions: %+v", q.Conditions)
+	}
+
+	invalid := []url.Values{
+		{"sort": {"password"}},
+		{"limit": {"51"}},
+		{"page": {"0"}},
+		{"created_after": {"yesterday"}},
+		{"cursor": {"!!"}},
+		{"cursor": {"e30"}, "sort": {"title,created_at"}},
+	}
+	for _, values := range invalid {
+		if _, err := Parse(values, testSpec); !IsInvalid(err) {
+			t.Errorf("Expected an invalid parameter error for %v; got %v", values, err)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	q, err := Parse(url.Values{"limit": {"2"}}, testSpec)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	items := []item{{ID: 1, Title: "a"}, {ID: 7, Title: "b"}, {ID: 3, Title: "c"}}
+	meta := q.Finish(&items, 5)
+	if len(items) != 2 {
+		t.Fatalf("Expected the page to be trimmed to 2 items; got %d", len(items))
+	}
+	if meta.TotalRecords != 5 || meta.TotalPages != 3 || meta.NextCursor == "" {
+		t.Fatalf("Unexpected metadata: %+v", meta)
+	}
+
+	next, err := Parse(url.Values{"limit": {"2"}, "cursor": {meta.NextCursor}}, testSpec)
+	if err != nil {
+		t.Fatalf("Parse of the next cursor failed: %v", err)
+	}
+	if next.Offset() != 0 {
+		t.Errorf("Expected no offset with a cursor; got %d", next.Offset())
+	}
+	condition := next.CursorCondition()
+	if condition == nil || condition.SQL != "(title, id) > (?, ?)" || condition.Args[0] != "b" || condition.Args[1] != uint(7) {
+		t.Errorf("Unexpected cursor condition: %+v", condition)
+	}
+
+	last := []item{{ID: 4, Title: "d"}}
+	if meta := next.Finish(&last, 5); meta.NextCursor != "" {
+		t.Errorf("Expected no cursor on the last page; got %q", meta.NextCursor)
+	}
+}